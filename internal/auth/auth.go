@@ -51,6 +51,14 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 	if err != nil {
 		return uuid.UUID{}, err
 	}
+	// tokens minted for another purpose carry an audience
+	audience, err := tkn.Claims.GetAudience()
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+	if len(audience) > 0 {
+		return uuid.UUID{}, fmt.Errorf("Error, not an access token.")
+	}
 	subject, err := tkn.Claims.GetSubject()
 	if err != nil {
 		return uuid.UUID{}, err
@@ -62,6 +70,45 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 	return out, nil
 }
 
+const verificationAudience = "email-verification"
+
+type verificationClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+// MakeVerificationToken signs a token proving control of email. It stops
+// working once the address is verified or changed.
+func MakeVerificationToken(userID uuid.UUID, email, tokenSecret string, expiresIn time.Duration) (string, error) {
+	currentTime := time.Now().UTC()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, verificationClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			Audience:  jwt.ClaimStrings{verificationAudience},
+			IssuedAt:  jwt.NewNumericDate(currentTime),
+			ExpiresAt: jwt.NewNumericDate(currentTime.Add(expiresIn)),
+			Subject:   userID.String(),
+		},
+	})
+	return token.SignedString([]byte(tokenSecret))
+}
+
+func ValidateVerificationToken(tokenString, tokenSecret string) (uuid.UUID, string, error) {
+	claims := verificationClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, &claims, func(t *jwt.Token) (any, error) {
+		return []byte(tokenSecret), nil
+	}, jwt.WithAudience(verificationAudience))
+	if err != nil {
+		return uuid.UUID{}, "", err
+	}
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.UUID{}, "", err
+	}
+	return userID, claims.Email, nil
+}
+
 func GetBearerToken(headers http.Header) (string, error) {
 	auth, ok := headers["Authorization"]
 	if !ok {
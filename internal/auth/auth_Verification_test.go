@@ -0,0 +1,47 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FG-GIS/boot-dev-chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestVerificationTokenRoundTrip(t *testing.T) {
+	id := uuid.New()
+	tkn, err := auth.MakeVerificationToken(id, "me@example.com", "secretToken", time.Minute)
+	if err != nil {
+		t.Fatalf("Error creating the token: %s", err)
+	}
+	gotID, email, err := auth.ValidateVerificationToken(tkn, "secretToken")
+	if err != nil {
+		t.Fatalf("Error validating the token: %s", err)
+	}
+	if gotID != id || email != "me@example.com" {
+		t.Errorf("Expected %s/%s, got %s/%s", id, "me@example.com", gotID, email)
+	}
+}
+
+func TestVerificationTokenRejected(t *testing.T) {
+	id := uuid.New()
+	expired, _ := auth.MakeVerificationToken(id, "me@example.com", "secretToken", -time.Minute)
+	if _, _, err := auth.ValidateVerificationToken(expired, "secretToken"); err == nil {
+		t.Error("Expired token validated")
+	}
+	valid, _ := auth.MakeVerificationToken(id, "me@example.com", "secretToken", time.Minute)
+	if _, _, err := auth.ValidateVerificationToken(valid, "otherSecret"); err == nil {
+		t.Error("Token validated with the wrong secret")
+	}
+	access, _ := auth.MakeJWT(id, "secretToken", time.Minute)
+	if _, _, err := auth.ValidateVerificationToken(access, "secretToken"); err == nil {
+		t.Error("Access token accepted as a verification token")
+	}
+}
+
+func TestVerificationTokenNotAnAccessToken(t *testing.T) {
+	tkn, _ := auth.MakeVerificationToken(uuid.New(), "me@example.com", "secretToken", time.Minute)
+	if _, err := auth.ValidateJWT(tkn, "secretToken"); err == nil {
+		t.Error("Verification token accepted as an access token")
+	}
+}
@@ -0,0 +1,119 @@
+package chirptext
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxTagLength    = 50
+	minHandleLength = 3
+	maxHandleLength = 15
+)
+
+var (
+	hashtagRegex = regexp.MustCompile(`(^|[\s(\[{"'])#([\p{L}\p{N}_]+)`)
+	mentionRegex = regexp.MustCompile(`(^|[\s(\[{"'])(@[A-Za-z0-9_]+)`)
+	handleRegex  = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
+// reservedHandles would be confused with the service itself or its routes.
+var reservedHandles = map[string]bool{
+	"admin": true, "administrator": true, "api": true, "app": true,
+	"chirpy": true, "everyone": true, "help": true, "login": true,
+	"logout": true, "me": true, "mod": true, "moderator": true,
+	"null": true, "official": true, "root": true, "settings": true,
+	"signup": true, "staff": true, "support": true, "system": true,
+	"undefined": true, "user": true, "users": true,
+}
+
+// Mention is an @handle token of a chirp body. Start and End are byte
+// offsets of the token, '@' included.
+type Mention struct {
+	Handle string
+	Start  int
+	End    int
+}
+
+// ExtractHashtags returns the lowercased, de-duplicated tags of a chirp
+// body in order of first appearance, without the leading '#'.
+func ExtractHashtags(body string) []string {
+	tags := []string{}
+	seen := map[string]bool{}
+	for _, match := range hashtagRegex.FindAllStringSubmatch(body, -1) {
+		tag := strings.ToLower(match[2])
+		if len([]rune(tag)) > maxTagLength || !hasLetter(tag) || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// ExtractMentions returns every @handle token of a chirp body in order,
+// with the handle lowercased and without the leading '@'.
+func ExtractMentions(body string) []Mention {
+	mentions := []Mention{}
+	for _, loc := range mentionRegex.FindAllStringSubmatchIndex(body, -1) {
+		start, end := loc[4], loc[5]
+		// glued to more text, as in an email address or a non-ASCII name
+		if gluedAt(body, end) {
+			continue
+		}
+		mentions = append(mentions, Mention{
+			Handle: strings.ToLower(body[start+1 : end]),
+			Start:  start,
+			End:    end,
+		})
+	}
+	return mentions
+}
+
+// ValidateHandle checks a user handle against the charset, length and
+// reserved name rules. Handles are compared case-insensitively.
+func ValidateHandle(handle string) error {
+	if len(handle) < minHandleLength || len(handle) > maxHandleLength {
+		return fmt.Errorf("Handle must be between %d and %d characters.", minHandleLength, maxHandleLength)
+	}
+	if !handleRegex.MatchString(handle) {
+		return fmt.Errorf("Handle can only contain letters, digits and underscores.")
+	}
+	if !hasLetter(handle) {
+		return fmt.Errorf("Handle must contain at least one letter.")
+	}
+	if reservedHandles[strings.ToLower(handle)] {
+		return fmt.Errorf("Handle %s is reserved.", handle)
+	}
+	return nil
+}
+
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+func hasLetter(s string) bool {
+	for _, r := range s {
+		if r != '_' && (r < '0' || r > '9') {
+			return true
+		}
+	}
+	return false
+}
+
+func gluedAt(body string, idx int) bool {
+	r, size := utf8.DecodeRuneInString(body[idx:])
+	switch {
+	case size == 0:
+		return false
+	case r == '@' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		return true
+	case r == '.':
+		next, _ := utf8.DecodeRuneInString(body[idx+size:])
+		return next == '_' || unicode.IsLetter(next) || unicode.IsDigit(next)
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package chirptext_test
+
+import (
+	"testing"
+
+	"github.com/FG-GIS/boot-dev-chirpy/internal/chirptext"
+)
+
+func TestValidateHandle(t *testing.T) {
+	cases := map[string]bool{
+		"alice":            true,
+		"Bob_42":           true,
+		"user_0a1b2c3d4e":  true,
+		"ab":               false,
+		"a_very_long_name": false,
+		"dash-ed":          false,
+		"émile":            false,
+		"12345":            false,
+		"___":              false,
+		"admin":            false,
+		"API":              false,
+	}
+	for handle, valid := range cases {
+		err := chirptext.ValidateHandle(handle)
+		if valid && err != nil {
+			t.Errorf("Handle [%s]: unexpected error %v\n", handle, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("Handle [%s]: expected an error\n", handle)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package chirptext_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/FG-GIS/boot-dev-chirpy/internal/chirptext"
+)
+
+func TestExtractHashtags(t *testing.T) {
+	cases := map[string][]string{
+		"no tags here":                       {},
+		"#golang is fun":                     {"golang"},
+		"I love #Go and #go and #Chirpy!":    {"go", "chirpy"},
+		"see issue #42 and url/#anchor":      {},
+		"mixed #café_2025, (#paren) #a#b":    {"café_2025", "paren", "a"},
+		"html &#39; entity and ##double tag": {},
+	}
+	for body, expected := range cases {
+		tags := chirptext.ExtractHashtags(body)
+		if !slices.Equal(tags, expected) {
+			t.Errorf("Body [%s]: expected %v, got %v\n", body, expected, tags)
+		}
+	}
+}
+
+func TestNormalizeTag(t *testing.T) {
+	tagSlice := []string{"#GoLang", "golang", " GOLANG "}
+	for idx, tag := range tagSlice {
+		if norm := chirptext.NormalizeTag(tag); norm != "golang" {
+			t.Errorf("Tag n.%d [%s] normalized to %s\n", idx, tag, norm)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package chirptext_test
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/FG-GIS/boot-dev-chirpy/internal/chirptext"
+)
+
+func TestExtractMentions(t *testing.T) {
+	cases := map[string][]chirptext.Mention{
+		"no mentions here":              {},
+		"@Alice hi":                     {{Handle: "alice", Start: 0, End: 6}},
+		"cc @bob, (@carol_2) and @bob.": {{Handle: "bob", Start: 3, End: 7}, {Handle: "carol_2", Start: 10, End: 18}, {Handle: "bob", Start: 24, End: 28}},
+		"mail me at me@example.com":     {},
+		"@dave@elsewhere.social":        {},
+		"café @émile":                   {},
+	}
+	for body, expected := range cases {
+		mentions := chirptext.ExtractMentions(body)
+		if !slices.Equal(mentions, expected) {
+			t.Errorf("Body [%s]: expected %v, got %v\n", body, expected, mentions)
+		}
+	}
+}
+
+func TestExtractMentionsOffsets(t *testing.T) {
+	body := "héllo @Zoë and @zed"
+	mentions := chirptext.ExtractMentions(body)
+	if len(mentions) != 1 {
+		t.Fatalf("Expected 1 mention, got %v\n", mentions)
+	}
+	if token := body[mentions[0].Start:mentions[0].End]; token != "@zed" {
+		t.Errorf("Offsets point at [%s], expected [@zed]\n", token)
+	}
+}
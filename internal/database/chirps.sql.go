@@ -7,34 +7,86 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const cancelScheduledChirp = `-- name: CancelScheduledChirp :execrows
+DELETE FROM chirps
+WHERE id = $1 AND user_id = $2 AND status = 'scheduled'
+`
+
+type CancelScheduledChirpParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) CancelScheduledChirp(ctx context.Context, arg CancelScheduledChirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelScheduledChirp, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createChirp = `-- name: CreateChirp :one
 INSERT INTO chirps (
   id,
   created_at,
   updated_at,
   body,
-  user_id
+  user_id,
+  in_reply_to,
+  ref_chirp_id,
+  ref_kind,
+  status,
+  publish_at,
+  expires_at,
+  visibility
 ) VALUES ( 
   gen_random_uuid(),
   NOW(),
   NOW(),
   $1,
-  $2
+  $2,
+  $3,
+  $4,
+  $5,
+  $6,
+  $7,
+  $8,
+  $9
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, search_vector, in_reply_to, tombstoned_at, ref_chirp_id, ref_kind, deleted_at, status, publish_at, expires_at, visibility
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body       string
+	UserID     uuid.UUID
+	InReplyTo  uuid.NullUUID
+	RefChirpID uuid.NullUUID
+	RefKind    sql.NullString
+	Status     string
+	PublishAt  sql.NullTime
+	ExpiresAt  sql.NullTime
+	Visibility ChirpVisibility
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.InReplyTo,
+		arg.RefChirpID,
+		arg.RefKind,
+		arg.Status,
+		arg.PublishAt,
+		arg.ExpiresAt,
+		arg.Visibility,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -42,25 +94,138 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.TombstonedAt,
+		&i.RefChirpID,
+		&i.RefKind,
+		&i.DeletedAt,
+		&i.Status,
+		&i.PublishAt,
+		&i.ExpiresAt,
+		&i.Visibility,
 	)
 	return i, err
 }
 
-const deleteChirpByID = `-- name: DeleteChirpByID :exec
-DELETE FROM chirps WHERE id = $1
+const deleteRechirp = `-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1 AND ref_chirp_id = $2 AND ref_kind = 'rechirp'
 `
 
-func (q *Queries) DeleteChirpByID(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteChirpByID, id)
-	return err
+type DeleteRechirpParams struct {
+	UserID     uuid.UUID
+	RefChirpID uuid.NullUUID
+}
+
+func (q *Queries) DeleteRechirp(ctx context.Context, arg DeleteRechirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteRechirp, arg.UserID, arg.RefChirpID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getChirpAncestors = `-- name: GetChirpAncestors :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, tombstoned_at, ref_chirp_id, ref_kind, deleted_at, status, publish_at, expires_at, visibility FROM chirps
+WHERE id IN (
+  WITH RECURSIVE ancestors(id, in_reply_to) AS (
+    SELECT parent.id, parent.in_reply_to FROM chirps parent
+    WHERE parent.id = (SELECT child.in_reply_to FROM chirps child WHERE child.id = $1::uuid)
+    UNION ALL
+    SELECT parent.id, parent.in_reply_to FROM chirps parent
+    JOIN ancestors ON parent.id = ancestors.in_reply_to
+  )
+  SELECT ancestors.id FROM ancestors
+)
+  AND chirp_visible_to(chirps, $2::uuid)
+ORDER BY created_at ASC, id ASC
+`
+
+type GetChirpAncestorsParams struct {
+	ChirpID  uuid.UUID
+	ViewerID uuid.UUID
+}
+
+func (q *Queries) GetChirpAncestors(ctx context.Context, arg GetChirpAncestorsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpAncestors, arg.ChirpID, arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.TombstonedAt,
+			&i.RefChirpID,
+			&i.RefKind,
+			&i.DeletedAt,
+			&i.Status,
+			&i.PublishAt,
+			&i.ExpiresAt,
+			&i.Visibility,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps WHERE id = $1
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, tombstoned_at, ref_chirp_id, ref_kind, deleted_at, status, publish_at, expires_at, visibility FROM chirps WHERE id = $1 AND deleted_at IS NULL AND status = 'published'
+  AND (expires_at IS NULL OR expires_at > NOW())
+  AND chirp_visible_to(chirps, $2::uuid)
 `
 
-func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, getChirpByID, id)
+type GetChirpByIDParams struct {
+	ID       uuid.UUID
+	ViewerID uuid.UUID
+}
+
+func (q *Queries) GetChirpByID(ctx context.Context, arg GetChirpByIDParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpByID, arg.ID, arg.ViewerID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.TombstonedAt,
+		&i.RefChirpID,
+		&i.RefKind,
+		&i.DeletedAt,
+		&i.Status,
+		&i.PublishAt,
+		&i.ExpiresAt,
+		&i.Visibility,
+	)
+	return i, err
+}
+
+const getChirpByIDWithDeleted = `-- name: GetChirpByIDWithDeleted :one
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, tombstoned_at, ref_chirp_id, ref_kind, deleted_at, status, publish_at, expires_at, visibility FROM chirps WHERE id = $1
+`
+
+func (q *Queries) GetChirpByIDWithDeleted(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpByIDWithDeleted, id)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -68,16 +233,106 @@ func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.TombstonedAt,
+		&i.RefChirpID,
+		&i.RefKind,
+		&i.DeletedAt,
+		&i.Status,
+		&i.PublishAt,
+		&i.ExpiresAt,
+		&i.Visibility,
 	)
 	return i, err
 }
 
+const getChirpReplies = `-- name: GetChirpReplies :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, tombstoned_at, ref_chirp_id, ref_kind, deleted_at, status, publish_at, expires_at, visibility FROM chirps
+WHERE id IN (
+  WITH RECURSIVE replies(id) AS (
+    SELECT child.id FROM chirps child
+    WHERE child.in_reply_to = $1::uuid
+    UNION ALL
+    SELECT child.id FROM chirps child
+    JOIN replies ON child.in_reply_to = replies.id
+  )
+  SELECT replies.id FROM replies
+)
+  AND (deleted_at IS NULL OR EXISTS (
+    SELECT 1 FROM chirps child WHERE child.in_reply_to = chirps.id
+  ))
+  AND status = 'published'
+  AND (expires_at IS NULL OR expires_at > NOW())
+  AND chirp_visible_to(chirps, $2::uuid)
+  AND ($3::timestamp IS NULL
+    OR (created_at, id) > ($3::timestamp, $4::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT $5
+`
+
+type GetChirpRepliesParams struct {
+	ChirpID         uuid.UUID
+	ViewerID        uuid.UUID
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	PageSize        int32
+}
+
+func (q *Queries) GetChirpReplies(ctx context.Context, arg GetChirpRepliesParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpReplies,
+		arg.ChirpID,
+		arg.ViewerID,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.TombstonedAt,
+			&i.RefChirpID,
+			&i.RefKind,
+			&i.DeletedAt,
+			&i.Status,
+			&i.PublishAt,
+			&i.ExpiresAt,
+			&i.Visibility,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps ORDER BY created_at ASC
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, tombstoned_at, ref_chirp_id, ref_kind, deleted_at, status, publish_at, expires_at, visibility FROM chirps WHERE deleted_at IS NULL AND status = 'published'
+  AND (expires_at IS NULL OR expires_at > NOW())
+  AND chirp_visible_to(chirps, $1::uuid)
+ORDER BY created_at ASC
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+func (q *Queries) GetChirps(ctx context.Context, viewerID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirps, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -91,6 +346,16 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.TombstonedAt,
+			&i.RefChirpID,
+			&i.RefKind,
+			&i.DeletedAt,
+			&i.Status,
+			&i.PublishAt,
+			&i.ExpiresAt,
+			&i.Visibility,
 		); err != nil {
 			return nil, err
 		}
@@ -104,3 +369,604 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 	}
 	return items, nil
 }
+
+const getChirpsByIDs = `-- name: GetChirpsByIDs :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, tombstoned_at, ref_chirp_id, ref_kind, deleted_at, status, publish_at, expires_at, visibility FROM chirps
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) GetChirpsByIDs(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIDs, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.TombstonedAt,
+			&i.RefChirpID,
+			&i.RefKind,
+			&i.DeletedAt,
+			&i.Status,
+			&i.PublishAt,
+			&i.ExpiresAt,
+			&i.Visibility,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsPage = `-- name: GetChirpsPage :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, tombstoned_at, ref_chirp_id, ref_kind, deleted_at, status, publish_at, expires_at, visibility FROM chirps
+WHERE deleted_at IS NULL
+  AND status = 'published'
+  AND (expires_at IS NULL OR expires_at > NOW())
+  AND chirp_visible_to(chirps, $1::uuid)
+  AND ($2::uuid IS NULL OR user_id = $2::uuid)
+  AND ($3::timestamp IS NULL OR created_at >= $3::timestamp)
+  AND ($4::timestamp IS NULL OR created_at < $4::timestamp)
+  AND ($5::timestamp IS NULL
+    OR (created_at, id) > ($5::timestamp, $6::uuid))
+  AND ($7::uuid IS NULL OR id <> $7::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT $8
+`
+
+type GetChirpsPageParams struct {
+	ViewerID        uuid.UUID
+	AuthorID        uuid.NullUUID
+	Since           sql.NullTime
+	Until           sql.NullTime
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	ExcludeID       uuid.NullUUID
+	PageSize        int32
+}
+
+func (q *Queries) GetChirpsPage(ctx context.Context, arg GetChirpsPageParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsPage,
+		arg.ViewerID,
+		arg.AuthorID,
+		arg.Since,
+		arg.Until,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.ExcludeID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.TombstonedAt,
+			&i.RefChirpID,
+			&i.RefKind,
+			&i.DeletedAt,
+			&i.Status,
+			&i.PublishAt,
+			&i.ExpiresAt,
+			&i.Visibility,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsPageDesc = `-- name: GetChirpsPageDesc :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, tombstoned_at, ref_chirp_id, ref_kind, deleted_at, status, publish_at, expires_at, visibility FROM chirps
+WHERE deleted_at IS NULL
+  AND status = 'published'
+  AND (expires_at IS NULL OR expires_at > NOW())
+  AND chirp_visible_to(chirps, $1::uuid)
+  AND ($2::uuid IS NULL OR user_id = $2::uuid)
+  AND ($3::timestamp IS NULL OR created_at >= $3::timestamp)
+  AND ($4::timestamp IS NULL OR created_at < $4::timestamp)
+  AND ($5::timestamp IS NULL
+    OR (created_at, id) < ($5::timestamp, $6::uuid))
+  AND ($7::uuid IS NULL OR id <> $7::uuid)
+ORDER BY created_at DESC, id DESC
+LIMIT $8
+`
+
+type GetChirpsPageDescParams struct {
+	ViewerID        uuid.UUID
+	AuthorID        uuid.NullUUID
+	Since           sql.NullTime
+	Until           sql.NullTime
+	CursorCreatedAt sql.NullTime
+	CursorID        uuid.NullUUID
+	ExcludeID       uuid.NullUUID
+	PageSize        int32
+}
+
+func (q *Queries) GetChirpsPageDesc(ctx context.Context, arg GetChirpsPageDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsPageDesc,
+		arg.ViewerID,
+		arg.AuthorID,
+		arg.Since,
+		arg.Until,
+		arg.CursorCreatedAt,
+		arg.CursorID,
+		arg.ExcludeID,
+		arg.PageSize,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.TombstonedAt,
+			&i.RefChirpID,
+			&i.RefKind,
+			&i.DeletedAt,
+			&i.Status,
+			&i.PublishAt,
+			&i.ExpiresAt,
+			&i.Visibility,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getDeletedChirpsByUser = `-- name: GetDeletedChirpsByUser :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, tombstoned_at, ref_chirp_id, ref_kind, deleted_at, status, publish_at, expires_at, visibility FROM chirps
+WHERE user_id = $1::uuid
+  AND deleted_at >= $2::timestamp
+  AND tombstoned_at IS NULL
+ORDER BY deleted_at DESC
+`
+
+type GetDeletedChirpsByUserParams struct {
+	UserID       uuid.UUID
+	DeletedSince time.Time
+}
+
+func (q *Queries) GetDeletedChirpsByUser(ctx context.Context, arg GetDeletedChirpsByUserParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getDeletedChirpsByUser, arg.UserID, arg.DeletedSince)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.TombstonedAt,
+			&i.RefChirpID,
+			&i.RefKind,
+			&i.DeletedAt,
+			&i.Status,
+			&i.PublishAt,
+			&i.ExpiresAt,
+			&i.Visibility,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getScheduledChirpsByUser = `-- name: GetScheduledChirpsByUser :many
+SELECT id, created_at, updated_at, body, user_id, search_vector, in_reply_to, tombstoned_at, ref_chirp_id, ref_kind, deleted_at, status, publish_at, expires_at, visibility FROM chirps
+WHERE user_id = $1
+  AND status = 'scheduled'
+  AND deleted_at IS NULL
+ORDER BY publish_at ASC, id ASC
+`
+
+func (q *Queries) GetScheduledChirpsByUser(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getScheduledChirpsByUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.TombstonedAt,
+			&i.RefChirpID,
+			&i.RefKind,
+			&i.DeletedAt,
+			&i.Status,
+			&i.PublishAt,
+			&i.ExpiresAt,
+			&i.Visibility,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const publishDueChirps = `-- name: PublishDueChirps :many
+UPDATE chirps
+SET status = 'published', created_at = NOW(), updated_at = NOW()
+WHERE id IN (
+  SELECT due.id FROM chirps due
+  WHERE due.status = 'scheduled'
+    AND due.publish_at <= NOW()
+    AND due.deleted_at IS NULL
+  ORDER BY due.publish_at
+  LIMIT $1
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, body, user_id, search_vector, in_reply_to, tombstoned_at, ref_chirp_id, ref_kind, deleted_at, status, publish_at, expires_at, visibility
+`
+
+func (q *Queries) PublishDueChirps(ctx context.Context, batchSize int32) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, publishDueChirps, batchSize)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.SearchVector,
+			&i.InReplyTo,
+			&i.TombstonedAt,
+			&i.RefChirpID,
+			&i.RefKind,
+			&i.DeletedAt,
+			&i.Status,
+			&i.PublishAt,
+			&i.ExpiresAt,
+			&i.Visibility,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeDeletedChirps = `-- name: PurgeDeletedChirps :execrows
+WITH purged AS (
+  SELECT parent.id FROM chirps parent
+  WHERE parent.deleted_at < $1::timestamp
+    AND NOT EXISTS (
+      SELECT 1 FROM chirps child WHERE child.in_reply_to = parent.id
+    )
+)
+DELETE FROM chirps
+WHERE id IN (SELECT id FROM purged)
+  -- plain rechirps go with their original, quotes keep their own body
+  OR (ref_kind = 'rechirp' AND ref_chirp_id IN (SELECT id FROM purged))
+`
+
+func (q *Queries) PurgeDeletedChirps(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedChirps, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const purgeExpiredChirps = `-- name: PurgeExpiredChirps :execrows
+WITH purged AS (
+  SELECT parent.id FROM chirps parent
+  WHERE parent.expires_at <= NOW()
+    AND NOT EXISTS (
+      SELECT 1 FROM chirps child WHERE child.in_reply_to = parent.id
+    )
+)
+DELETE FROM chirps
+WHERE id IN (SELECT id FROM purged)
+  -- rechirps follow their original, as in PurgeDeletedChirps
+  OR (ref_kind = 'rechirp' AND ref_chirp_id IN (SELECT id FROM purged))
+`
+
+func (q *Queries) PurgeExpiredChirps(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeExpiredChirps)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rescheduleChirp = `-- name: RescheduleChirp :one
+UPDATE chirps
+SET publish_at = $3, expires_at = expires_at + ($3 - publish_at), updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND status = 'scheduled' AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id, search_vector, in_reply_to, tombstoned_at, ref_chirp_id, ref_kind, deleted_at, status, publish_at, expires_at, visibility
+`
+
+type RescheduleChirpParams struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	PublishAt sql.NullTime
+}
+
+func (q *Queries) RescheduleChirp(ctx context.Context, arg RescheduleChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, rescheduleChirp, arg.ID, arg.UserID, arg.PublishAt)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.TombstonedAt,
+		&i.RefChirpID,
+		&i.RefKind,
+		&i.DeletedAt,
+		&i.Status,
+		&i.PublishAt,
+		&i.ExpiresAt,
+		&i.Visibility,
+	)
+	return i, err
+}
+
+const restoreChirp = `-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NOT NULL AND tombstoned_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id, search_vector, in_reply_to, tombstoned_at, ref_chirp_id, ref_kind, deleted_at, status, publish_at, expires_at, visibility
+`
+
+func (q *Queries) RestoreChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, restoreChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.TombstonedAt,
+		&i.RefChirpID,
+		&i.RefKind,
+		&i.DeletedAt,
+		&i.Status,
+		&i.PublishAt,
+		&i.ExpiresAt,
+		&i.Visibility,
+	)
+	return i, err
+}
+
+const searchChirps = `-- name: SearchChirps :many
+SELECT
+  chirps.id,
+  ts_rank(chirps.search_vector, query)::real AS rank,
+  -- the body is HTML-escaped so that only the <mark> tags are markup
+  ts_headline('english',
+    REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(chirps.body, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;'),
+    query, 'StartSel=<mark>, StopSel=</mark>')::text AS headline
+FROM chirps, websearch_to_tsquery('english', $1::text) query
+WHERE chirps.search_vector @@ query
+  AND chirps.deleted_at IS NULL
+  AND chirps.status = 'published'
+  AND (chirps.expires_at IS NULL OR chirps.expires_at > NOW())
+  AND chirp_visible_to(chirps, $2::uuid)
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id ASC
+LIMIT $3 OFFSET $4
+`
+
+type SearchChirpsParams struct {
+	Query      string
+	ViewerID   uuid.UUID
+	PageSize   int32
+	PageOffset int32
+}
+
+type SearchChirpsRow struct {
+	ID       uuid.UUID
+	Rank     float32
+	Headline string
+}
+
+func (q *Queries) SearchChirps(ctx context.Context, arg SearchChirpsParams) ([]SearchChirpsRow, error) {
+	rows, err := q.db.QueryContext(ctx, searchChirps,
+		arg.Query,
+		arg.ViewerID,
+		arg.PageSize,
+		arg.PageOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchChirpsRow
+	for rows.Next() {
+		var i SearchChirpsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Rank,
+			&i.Headline,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const softDeleteChirp = `-- name: SoftDeleteChirp :exec
+UPDATE chirps
+SET deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) SoftDeleteChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, softDeleteChirp, id)
+	return err
+}
+
+const tombstoneDeletedChirps = `-- name: TombstoneDeletedChirps :execrows
+UPDATE chirps
+SET body = '', tombstoned_at = NOW()
+WHERE deleted_at < $1::timestamp
+  AND tombstoned_at IS NULL
+  AND EXISTS (
+    SELECT 1 FROM chirps child WHERE child.in_reply_to = chirps.id
+  )
+`
+
+func (q *Queries) TombstoneDeletedChirps(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, tombstoneDeletedChirps, deletedBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const tombstoneExpiredChirps = `-- name: TombstoneExpiredChirps :execrows
+UPDATE chirps
+SET body = '', tombstoned_at = NOW(), deleted_at = COALESCE(deleted_at, NOW()), expires_at = NULL
+WHERE expires_at <= NOW()
+  AND EXISTS (
+    SELECT 1 FROM chirps child WHERE child.in_reply_to = chirps.id
+  )
+`
+
+func (q *Queries) TombstoneExpiredChirps(ctx context.Context) (int64, error) {
+	result, err := q.db.ExecContext(ctx, tombstoneExpiredChirps)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateChirpBody = `-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, body, user_id, search_vector, in_reply_to, tombstoned_at, ref_chirp_id, ref_kind, deleted_at, status, publish_at, expires_at, visibility
+`
+
+type UpdateChirpBodyParams struct {
+	ID   uuid.UUID
+	Body string
+}
+
+func (q *Queries) UpdateChirpBody(ctx context.Context, arg UpdateChirpBodyParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirpBody, arg.ID, arg.Body)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.SearchVector,
+		&i.InReplyTo,
+		&i.TombstonedAt,
+		&i.RefChirpID,
+		&i.RefKind,
+		&i.DeletedAt,
+		&i.Status,
+		&i.PublishAt,
+		&i.ExpiresAt,
+		&i.Visibility,
+	)
+	return i, err
+}
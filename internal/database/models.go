@@ -6,17 +6,200 @@ package database
 
 import (
 	"database/sql"
+	"database/sql/driver"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type ChirpVisibility string
+
+const (
+	ChirpVisibilityPublic    ChirpVisibility = "public"
+	ChirpVisibilityFollowers ChirpVisibility = "followers"
+	ChirpVisibilityMentioned ChirpVisibility = "mentioned"
+)
+
+func (e *ChirpVisibility) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		*e = ChirpVisibility(s)
+	case string:
+		*e = ChirpVisibility(s)
+	default:
+		return fmt.Errorf("unsupported scan type for ChirpVisibility: %T", src)
+	}
+	return nil
+}
+
+type NullChirpVisibility struct {
+	ChirpVisibility ChirpVisibility
+	Valid           bool // Valid is true if ChirpVisibility is not NULL
+}
+
+// Scan implements the Scanner interface.
+func (ns *NullChirpVisibility) Scan(value interface{}) error {
+	if value == nil {
+		ns.ChirpVisibility, ns.Valid = "", false
+		return nil
+	}
+	ns.Valid = true
+	return ns.ChirpVisibility.Scan(value)
+}
+
+// Value implements the driver Valuer interface.
+func (ns NullChirpVisibility) Value() (driver.Value, error) {
+	if !ns.Valid {
+		return nil, nil
+	}
+	return string(ns.ChirpVisibility), nil
+}
+
+type Bookmark struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
 type Chirp struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Body         string
+	UserID       uuid.UUID
+	SearchVector interface{}
+	InReplyTo    uuid.NullUUID
+	TombstonedAt sql.NullTime
+	RefChirpID   uuid.NullUUID
+	RefKind      sql.NullString
+	DeletedAt    sql.NullTime
+	Status       string
+	PublishAt    sql.NullTime
+	ExpiresAt    sql.NullTime
+	Visibility   ChirpVisibility
+}
+
+type ChirpHashtag struct {
+	ChirpID   uuid.UUID
+	HashtagID uuid.UUID
+	CreatedAt time.Time
+}
+
+type ChirpLike struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type ChirpMedium struct {
+	ChirpID  uuid.UUID
+	MediaID  uuid.UUID
+	Position int32
+}
+
+type ChirpMention struct {
+	ChirpID     uuid.UUID
+	UserID      uuid.UUID
+	StartOffset int32
+	EndOffset   int32
+}
+
+type ChirpRevision struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	Body       string
+	CreatedAt  time.Time
+	ReplacedAt time.Time
+}
+
+type Draft struct {
 	ID        uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	UserID    uuid.UUID
 	Body      string
+	InReplyTo uuid.NullUUID
+	MediaIds  []uuid.UUID
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type Hashtag struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	Tag       string
+}
+
+type Medium struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UserID      uuid.UUID
+	ContentType string
+	StorageKey  string
+	SizeBytes   int64
+	Width       int32
+	Height      int32
+	Blurhash    sql.NullString
+	ProcessedAt sql.NullTime
+	Attempts    int32
+	ClaimedAt   sql.NullTime
+}
+
+type MediaVariant struct {
+	MediaID    uuid.UUID
+	Name       string
+	StorageKey string
+	Width      int32
+	Height     int32
+}
+
+type Notification struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
 	UserID    uuid.UUID
+	Kind      string
+	ActorID   uuid.UUID
+	ChirpID   uuid.UUID
+	ReadAt    sql.NullTime
+}
+
+type PasswordReset struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type PinnedChirp struct {
+	UserID    uuid.UUID
+	ChirpID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type Poll struct {
+	ChirpID  uuid.UUID
+	ClosesAt time.Time
+}
+
+type PollOption struct {
+	ID       uuid.UUID
+	ChirpID  uuid.UUID
+	Position int32
+	Body     string
+}
+
+type PollVote struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	OptionID  uuid.UUID
+	CreatedAt time.Time
 }
 
 type RefreshToken struct {
@@ -29,9 +212,17 @@ type RefreshToken struct {
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	HashedPassword  string
+	IsAdmin         bool
+	Handle          string
+	DisplayName     string
+	Bio             string
+	AvatarMediaID   uuid.NullUUID
+	Location        string
+	Website         string
+	EmailVerifiedAt sql.NullTime
 }
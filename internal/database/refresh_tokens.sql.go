@@ -66,7 +66,7 @@ func (q *Queries) GetRefreshToken(ctx context.Context, token string) (RefreshTok
 }
 
 const getUserFromRefreshToken = `-- name: GetUserFromRefreshToken :one
-SELECT id, created_at, updated_at, email, hashed_password FROM users WHERE id = (
+SELECT id, created_at, updated_at, email, hashed_password, is_admin, handle, display_name, bio, avatar_media_id, location, website, email_verified_at FROM users WHERE id = (
   SELECT user_id FROM refresh_tokens
   WHERE token = $1
 )
@@ -81,10 +81,37 @@ func (q *Queries) GetUserFromRefreshToken(ctx context.Context, token string) (Us
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.IsAdmin,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.Location,
+		&i.Website,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
+const revokeOtherRefreshTokens = `-- name: RevokeOtherRefreshTokens :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND token <> $2 AND revoked_at IS NULL
+`
+
+type RevokeOtherRefreshTokensParams struct {
+	UserID uuid.UUID
+	Token  string
+}
+
+func (q *Queries) RevokeOtherRefreshTokens(ctx context.Context, arg RevokeOtherRefreshTokensParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeOtherRefreshTokens, arg.UserID, arg.Token)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const revokeRefreshToken = `-- name: RevokeRefreshToken :one
 UPDATE refresh_tokens 
 SET revoked_at = $2, updated_at = $2
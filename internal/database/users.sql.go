@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,20 +19,23 @@ INSERT INTO users (
   created_at,
   updated_at,
   email,
-  hashed_password
+  hashed_password,
+  handle
 ) VALUES ( 
   gen_random_uuid(),
   NOW(),
   NOW(),
   $1,
-  $2
+  $2,
+  $3
 )
-RETURNING id,created_at,updated_at,email
+RETURNING id,created_at,updated_at,email,handle
 `
 
 type CreateUserParams struct {
 	Email          string
 	HashedPassword string
+	Handle         string
 }
 
 type CreateUserRow struct {
@@ -39,22 +43,76 @@ type CreateUserRow struct {
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	Email     string
+	Handle    string
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (CreateUserRow, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, createUser, arg.Email, arg.HashedPassword, arg.Handle)
 	var i CreateUserRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Email,
+		&i.Handle,
+	)
+	return i, err
+}
+
+const getUserByHandle = `-- name: GetUserByHandle :one
+SELECT id, created_at, updated_at, email, hashed_password, is_admin, handle, display_name, bio, avatar_media_id, location, website, email_verified_at FROM users
+WHERE LOWER(handle) = LOWER($1)
+`
+
+func (q *Queries) GetUserByHandle(ctx context.Context, lower string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByHandle, lower)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsAdmin,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.Location,
+		&i.Website,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, created_at, updated_at, email, hashed_password, is_admin, handle, display_name, bio, avatar_media_id, location, website, email_verified_at FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsAdmin,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.Location,
+		&i.Website,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
 const getUserByMail = `-- name: GetUserByMail :one
-SELECT id, created_at, updated_at, email, hashed_password FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_admin, handle, display_name, bio, avatar_media_id, location, website, email_verified_at FROM users
 WHERE email=$1
 `
 
@@ -67,6 +125,75 @@ func (q *Queries) GetUserByMail(ctx context.Context, email string) (User, error)
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.IsAdmin,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.Location,
+		&i.Website,
+		&i.EmailVerifiedAt,
+	)
+	return i, err
+}
+
+const getUserProfile = `-- name: GetUserProfile :one
+SELECT
+  users.id,
+  users.created_at,
+  users.handle,
+  users.display_name,
+  users.bio,
+  users.location,
+  users.website,
+  media.storage_key AS avatar_key,
+  (SELECT COUNT(*) FROM chirps
+    WHERE chirps.user_id = users.id
+      AND chirps.deleted_at IS NULL
+      AND chirps.status = 'published'
+      AND (chirps.expires_at IS NULL OR chirps.expires_at > NOW())
+      AND chirp_visible_to(chirps, $1::uuid)) AS chirp_count,
+  (SELECT COUNT(*) FROM follows WHERE follows.followee_id = users.id) AS follower_count,
+  (SELECT COUNT(*) FROM follows WHERE follows.follower_id = users.id) AS following_count
+FROM users
+LEFT JOIN media ON media.id = users.avatar_media_id
+WHERE users.id = $2
+`
+
+type GetUserProfileParams struct {
+	ViewerID uuid.UUID
+	ID       uuid.UUID
+}
+
+type GetUserProfileRow struct {
+	ID             uuid.UUID
+	CreatedAt      time.Time
+	Handle         string
+	DisplayName    string
+	Bio            string
+	Location       string
+	Website        string
+	AvatarKey      sql.NullString
+	ChirpCount     int64
+	FollowerCount  int64
+	FollowingCount int64
+}
+
+func (q *Queries) GetUserProfile(ctx context.Context, arg GetUserProfileParams) (GetUserProfileRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserProfile, arg.ViewerID, arg.ID)
+	var i GetUserProfileRow
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.Location,
+		&i.Website,
+		&i.AvatarKey,
+		&i.ChirpCount,
+		&i.FollowerCount,
+		&i.FollowingCount,
 	)
 	return i, err
 }
@@ -82,19 +209,29 @@ func (q *Queries) Reset(ctx context.Context) error {
 
 const updateCredentials = `-- name: UpdateCredentials :one
 UPDATE users
-SET email = $2, hashed_password = $3
-WHERE id = $1
-RETURNING id, created_at, updated_at, email, hashed_password
+SET email = COALESCE($1, email),
+  hashed_password = COALESCE($2, hashed_password),
+  handle = COALESCE($3, handle),
+  email_verified_at = CASE WHEN $1::text IS NULL THEN email_verified_at ELSE NULL END,
+  updated_at = NOW()
+WHERE id = $4
+RETURNING id, created_at, updated_at, email, hashed_password, is_admin, handle, display_name, bio, avatar_media_id, location, website, email_verified_at
 `
 
 type UpdateCredentialsParams struct {
+	Email          sql.NullString
+	HashedPassword sql.NullString
+	Handle         sql.NullString
 	ID             uuid.UUID
-	Email          string
-	HashedPassword string
 }
 
 func (q *Queries) UpdateCredentials(ctx context.Context, arg UpdateCredentialsParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateCredentials, arg.ID, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, updateCredentials,
+		arg.Email,
+		arg.HashedPassword,
+		arg.Handle,
+		arg.ID,
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -102,6 +239,67 @@ func (q *Queries) UpdateCredentials(ctx context.Context, arg UpdateCredentialsPa
 		&i.UpdatedAt,
 		&i.Email,
 		&i.HashedPassword,
+		&i.IsAdmin,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarMediaID,
+		&i.Location,
+		&i.Website,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
+
+const updateProfile = `-- name: UpdateProfile :exec
+UPDATE users
+SET display_name = COALESCE($1, display_name),
+  bio = COALESCE($2, bio),
+  location = COALESCE($3, location),
+  website = COALESCE($4, website),
+  avatar_media_id = CASE WHEN $5::boolean THEN $6::uuid ELSE avatar_media_id END,
+  updated_at = NOW()
+WHERE id = $7
+`
+
+type UpdateProfileParams struct {
+	DisplayName   sql.NullString
+	Bio           sql.NullString
+	Location      sql.NullString
+	Website       sql.NullString
+	SetAvatar     bool
+	AvatarMediaID uuid.NullUUID
+	ID            uuid.UUID
+}
+
+func (q *Queries) UpdateProfile(ctx context.Context, arg UpdateProfileParams) error {
+	_, err := q.db.ExecContext(ctx, updateProfile,
+		arg.DisplayName,
+		arg.Bio,
+		arg.Location,
+		arg.Website,
+		arg.SetAvatar,
+		arg.AvatarMediaID,
+		arg.ID,
+	)
+	return err
+}
+
+const verifyEmail = `-- name: VerifyEmail :execrows
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2 AND email_verified_at IS NULL
+`
+
+type VerifyEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) VerifyEmail(ctx context.Context, arg VerifyEmailParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, verifyEmail, arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,153 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mailer sends plain text emails.
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// SMTPMailer delivers through an SMTP relay, authenticating with PLAIN
+// auth when a username is set.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: username,
+		Password: password,
+		From:     from,
+	}
+}
+
+// sendTimeout bounds a delivery whose context carries no deadline.
+const sendTimeout = 30 * time.Second
+
+// Send delivers the message like smtp.SendMail, upgrading to TLS when the
+// relay offers STARTTLS, but gives up once ctx is done or its deadline
+// (sendTimeout when it has none) passes, so a stalled relay can't hang the
+// caller.
+func (sm *SMTPMailer) Send(ctx context.Context, to, subject, body string) error {
+	msg, err := buildMessage(sm.From, to, subject, body)
+	if err != nil {
+		return err
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, sendTimeout)
+		defer cancel()
+	}
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(sm.Host, sm.Port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		return err
+	}
+	// a cancelled ctx unblocks any read or write in flight
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	client, err := smtp.NewClient(conn, sm.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		err = client.StartTLS(&tls.Config{ServerName: sm.Host})
+		if err != nil {
+			return err
+		}
+	}
+	if sm.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", sm.Username, sm.Password, sm.Host))
+		if err != nil {
+			return err
+		}
+	}
+	err = client.Mail(sm.From)
+	if err != nil {
+		return err
+	}
+	err = client.Rcpt(to)
+	if err != nil {
+		return err
+	}
+	wc, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = wc.Write(msg)
+	if err != nil {
+		return err
+	}
+	err = wc.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// LogMailer writes every message to Out instead of sending it, for
+// development.
+type LogMailer struct {
+	mu   sync.Mutex
+	From string
+	Out  io.Writer
+}
+
+func NewLogMailer(from string, out io.Writer) *LogMailer {
+	return &LogMailer{From: from, Out: out}
+}
+
+func (lm *LogMailer) Send(ctx context.Context, to, subject, body string) error {
+	msg, err := buildMessage(lm.From, to, subject, body)
+	if err != nil {
+		return err
+	}
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	_, err = lm.Out.Write(append(msg, '\n'))
+	return err
+}
+
+func buildMessage(from, to, subject, body string) ([]byte, error) {
+	for _, header := range []string{from, to, subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, fmt.Errorf("Error, line break in mail header: %q", header)
+		}
+	}
+	msg := bytes.Buffer{}
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return msg.Bytes(), nil
+}
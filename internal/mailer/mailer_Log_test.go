@@ -0,0 +1,42 @@
+package mailer_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/FG-GIS/boot-dev-chirpy/internal/mailer"
+)
+
+func TestLogMailerSend(t *testing.T) {
+	out := bytes.Buffer{}
+	lm := mailer.NewLogMailer("chirpy@example.com", &out)
+	err := lm.Send(context.Background(), "me@example.com", "Hello", "line one\nline two")
+	if err != nil {
+		t.Fatalf("Error sending: %s", err)
+	}
+	msg := out.String()
+	for _, expected := range []string{
+		"From: chirpy@example.com\r\n",
+		"To: me@example.com\r\n",
+		"Subject: Hello\r\n",
+		"\r\n\r\nline one\r\nline two",
+	} {
+		if !strings.Contains(msg, expected) {
+			t.Errorf("Message missing %q:\n%s", expected, msg)
+		}
+	}
+}
+
+func TestLogMailerHeaderInjection(t *testing.T) {
+	out := bytes.Buffer{}
+	lm := mailer.NewLogMailer("chirpy@example.com", &out)
+	err := lm.Send(context.Background(), "me@example.com\r\nBcc: you@example.com", "Hello", "body")
+	if err == nil {
+		t.Error("Header injection not rejected")
+	}
+	if out.Len() != 0 {
+		t.Errorf("Rejected message was written: %s", out.String())
+	}
+}
@@ -0,0 +1,61 @@
+package mailer_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/FG-GIS/boot-dev-chirpy/internal/mailer"
+)
+
+// stalledRelay accepts connections and never answers, like a hung server.
+func stalledRelay(t *testing.T) (string, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error listening: %s", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(io.Discard, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	return host, port
+}
+
+func TestSMTPMailerStalledRelay(t *testing.T) {
+	host, port := stalledRelay(t)
+	sm := mailer.NewSMTPMailer(host, port, "", "", "chirpy@example.com")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := sm.Send(ctx, "me@example.com", "Hello", "body")
+	if err == nil {
+		t.Errorf("Send to a stalled relay did not error out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Send ignored its deadline, took %s", elapsed)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start = time.Now()
+	err = sm.Send(ctx, "me@example.com", "Hello", "body")
+	if err == nil {
+		t.Errorf("Send to a stalled relay did not error out after cancel")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Send ignored cancellation, took %s", elapsed)
+	}
+}
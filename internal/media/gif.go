@@ -0,0 +1,77 @@
+package media
+
+import (
+	"fmt"
+)
+
+// MaxFrames caps the number of frames in an animated gif.
+const MaxFrames = 500
+
+var errTruncatedGIF = fmt.Errorf("Error reading gif: unexpected end of data.")
+
+// gifFramePixels walks the blocks of a gif without decoding any of them and
+// returns how many frames it holds and the summed area of those frames,
+// which is what gif.DecodeAll would allocate.
+func gifFramePixels(data []byte) (int, int, error) {
+	if len(data) < 13 {
+		return 0, 0, errTruncatedGIF
+	}
+	idx := 13
+	if data[10]&0x80 != 0 {
+		idx += 3 << (data[10]&0x07 + 1)
+	}
+	frames, pixels := 0, 0
+	// data ending without a trailer is left for gif.DecodeAll to judge
+	for idx < len(data) {
+		switch data[idx] {
+		case 0x21:
+			next, err := skipSubBlocks(data, idx+2)
+			if err != nil {
+				return 0, 0, err
+			}
+			idx = next
+		case 0x2C:
+			if idx+10 > len(data) {
+				return 0, 0, errTruncatedGIF
+			}
+			width := int(data[idx+5]) | int(data[idx+6])<<8
+			height := int(data[idx+7]) | int(data[idx+8])<<8
+			frames++
+			pixels += width * height
+			if frames > MaxFrames || pixels > MaxPixels {
+				return frames, pixels, nil
+			}
+			next := idx + 10
+			if data[idx+9]&0x80 != 0 {
+				next += 3 << (data[idx+9]&0x07 + 1)
+			}
+			// the LZW minimum code size comes before the image data
+			next, err := skipSubBlocks(data, next+1)
+			if err != nil {
+				return 0, 0, err
+			}
+			idx = next
+		case 0x3B:
+			return frames, pixels, nil
+		default:
+			return 0, 0, fmt.Errorf("Error reading gif: unknown block 0x%02x.", data[idx])
+		}
+	}
+	return frames, pixels, nil
+}
+
+// skipSubBlocks returns the offset right after the chain of length-prefixed
+// sub-blocks starting at idx.
+func skipSubBlocks(data []byte, idx int) (int, error) {
+	for {
+		if idx >= len(data) {
+			return 0, errTruncatedGIF
+		}
+		size := int(data[idx])
+		idx++
+		if size == 0 {
+			return idx, nil
+		}
+		idx += size
+	}
+}
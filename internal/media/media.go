@@ -0,0 +1,122 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+var extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Decoded images are capped in both directions and in total pixel count, so
+// a small file declaring a huge canvas cannot exhaust memory.
+const (
+	MaxDimension = 8192
+	MaxPixels    = 32_000_000
+)
+
+var ErrUnsupportedType = fmt.Errorf("Error, unsupported media type.")
+var ErrImageTooLarge = fmt.Errorf("Error, image dimensions are too large.")
+
+// Extension returns the file extension used when storing contentType.
+func Extension(contentType string) string {
+	return extensions[contentType]
+}
+
+// checkSize reads the header of an encoded image and rejects canvases over
+// MaxDimension or MaxPixels before anything is decoded. For gifs the frames
+// are counted too, since every one of them is decoded.
+func checkSize(data []byte) error {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("Error reading image header: %s", err)
+	}
+	if cfg.Width > MaxDimension || cfg.Height > MaxDimension || cfg.Width*cfg.Height > MaxPixels {
+		return ErrImageTooLarge
+	}
+	if format != "gif" {
+		return nil
+	}
+	frames, pixels, err := gifFramePixels(data)
+	if err != nil {
+		return err
+	}
+	if frames > MaxFrames || pixels > MaxPixels {
+		return ErrImageTooLarge
+	}
+	return nil
+}
+
+// Decode decodes an image after checking its declared size against the
+// same limits Sanitize applies.
+func Decode(data []byte) (image.Image, error) {
+	err := checkSize(data)
+	if err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// Sanitize sniffs the real type of an upload and re-encodes it, which drops
+// EXIF blocks and any other metadata carried by the original file. Jpegs
+// are first turned upright according to their Exif orientation.
+func Sanitize(data []byte) ([]byte, string, error) {
+	contentType := http.DetectContentType(data)
+	if _, ok := extensions[contentType]; !ok {
+		return nil, "", ErrUnsupportedType
+	}
+	err := checkSize(data)
+	if err != nil {
+		return nil, "", err
+	}
+	out := bytes.Buffer{}
+	switch contentType {
+	case "image/jpeg":
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", fmt.Errorf("Error decoding jpeg: %s", err)
+		}
+		img = orient(img, exifOrientation(data))
+		err = jpeg.Encode(&out, img, &jpeg.Options{Quality: 90})
+		if err != nil {
+			return nil, "", err
+		}
+	case "image/png":
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", fmt.Errorf("Error decoding png: %s", err)
+		}
+		err = png.Encode(&out, img)
+		if err != nil {
+			return nil, "", err
+		}
+	case "image/gif":
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", fmt.Errorf("Error decoding gif: %s", err)
+		}
+		err = gif.EncodeAll(&out, anim)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return out.Bytes(), contentType, nil
+}
+
+// Dimensions reads the size of an encoded image without decoding it fully.
+func Dimensions(data []byte) (int, int, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	return cfg.Width, cfg.Height, nil
+}
@@ -0,0 +1,197 @@
+package media_test
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/FG-GIS/boot-dev-chirpy/internal/media"
+)
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 6))
+	for x := 0; x < 8; x++ {
+		for y := 0; y < 6; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * 30), uint8(y * 40), 128, 255})
+		}
+	}
+	return img
+}
+
+// withExif injects an APP1 Exif segment right after the SOI marker.
+func withExif(jpg []byte) []byte {
+	payload := []byte("Exif\x00\x00GPS-SECRET-LOCATION")
+	segment := []byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}
+	segment = append(segment, payload...)
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func TestSanitizeStripsExif(t *testing.T) {
+	buf := bytes.Buffer{}
+	err := jpeg.Encode(&buf, testImage(), nil)
+	if err != nil {
+		t.Fatalf("Error encoding test jpeg: %s", err)
+	}
+	dirty := withExif(buf.Bytes())
+	if !bytes.Contains(dirty, []byte("GPS-SECRET")) {
+		t.Fatalf("Test jpeg is missing its exif block")
+	}
+	clean, contentType, err := media.Sanitize(dirty)
+	if err != nil {
+		t.Errorf("Error sanitizing jpeg: %s", err)
+	}
+	if contentType != "image/jpeg" {
+		t.Errorf("Expected image/jpeg, got %s\n", contentType)
+	}
+	if bytes.Contains(clean, []byte("Exif")) || bytes.Contains(clean, []byte("GPS-SECRET")) {
+		t.Errorf("Sanitized jpeg still carries exif data")
+	}
+}
+
+func TestSanitizePNG(t *testing.T) {
+	buf := bytes.Buffer{}
+	err := png.Encode(&buf, testImage())
+	if err != nil {
+		t.Fatalf("Error encoding test png: %s", err)
+	}
+	clean, contentType, err := media.Sanitize(buf.Bytes())
+	if err != nil {
+		t.Errorf("Error sanitizing png: %s", err)
+	}
+	if contentType != "image/png" || media.Extension(contentType) != ".png" {
+		t.Errorf("Expected image/png, got %s\n", contentType)
+	}
+	width, height, err := media.Dimensions(clean)
+	if err != nil || width != 8 || height != 6 {
+		t.Errorf("Expected 8x6, got %dx%d (%v)", width, height, err)
+	}
+}
+
+func TestSanitizeFail(t *testing.T) {
+	dataSlice := [][]byte{
+		[]byte("plain text pretending to be an image"),
+		[]byte("<html><body>nope</body></html>"),
+		append([]byte{0xFF, 0xD8, 0xFF}, []byte("truncated jpeg")...),
+	}
+	for idx, data := range dataSlice {
+		_, _, err := media.Sanitize(data)
+		if err == nil {
+			t.Errorf("Data n.%d did not error out", idx)
+		}
+	}
+}
+
+// withOrientation injects a little-endian Exif block holding only the
+// orientation tag right after the SOI marker.
+func withOrientation(jpg []byte, orientation byte) []byte {
+	payload := []byte("Exif\x00\x00II\x2A\x00\x08\x00\x00\x00")
+	payload = append(payload, 0x01, 0x00)
+	payload = append(payload, 0x12, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, orientation, 0x00, 0x00, 0x00)
+	payload = append(payload, 0x00, 0x00, 0x00, 0x00)
+	segment := []byte{0xFF, 0xE1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}
+	segment = append(segment, payload...)
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func TestSanitizeOrientation(t *testing.T) {
+	buf := bytes.Buffer{}
+	err := jpeg.Encode(&buf, testImage(), nil)
+	if err != nil {
+		t.Fatalf("Error encoding test jpeg: %s", err)
+	}
+	cases := []struct {
+		orientation byte
+		expW, expH  int
+	}{
+		{1, 8, 6},
+		{3, 8, 6},
+		{6, 6, 8},
+		{8, 6, 8},
+	}
+	for _, c := range cases {
+		clean, _, err := media.Sanitize(withOrientation(buf.Bytes(), c.orientation))
+		if err != nil {
+			t.Errorf("Error sanitizing orientation %d: %s", c.orientation, err)
+			continue
+		}
+		width, height, err := media.Dimensions(clean)
+		if err != nil || width != c.expW || height != c.expH {
+			t.Errorf("Orientation %d: expected %dx%d, got %dx%d (%v)", c.orientation, c.expW, c.expH, width, height, err)
+		}
+	}
+}
+
+func TestSanitizeTooLarge(t *testing.T) {
+	cases := []image.Rectangle{
+		image.Rect(0, 0, 1, media.MaxDimension+1),
+		image.Rect(0, 0, media.MaxDimension, media.MaxPixels/media.MaxDimension+1),
+	}
+	for idx, rect := range cases {
+		buf := bytes.Buffer{}
+		err := png.Encode(&buf, image.NewGray(rect))
+		if err != nil {
+			t.Fatalf("Error encoding test png: %s", err)
+		}
+		_, _, err = media.Sanitize(buf.Bytes())
+		if !errors.Is(err, media.ErrImageTooLarge) {
+			t.Errorf("Image n.%d: expected ErrImageTooLarge, got %v", idx, err)
+		}
+		_, err = media.Decode(buf.Bytes())
+		if !errors.Is(err, media.ErrImageTooLarge) {
+			t.Errorf("Image n.%d: Decode expected ErrImageTooLarge, got %v", idx, err)
+		}
+	}
+}
+
+// testGIF encodes an animation of count solid frames of the given size.
+func testGIF(t *testing.T, width, height, count int) []byte {
+	frame := image.NewPaletted(image.Rect(0, 0, width, height), palette.Plan9)
+	anim := gif.GIF{}
+	for range count {
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, 10)
+	}
+	buf := bytes.Buffer{}
+	err := gif.EncodeAll(&buf, &anim)
+	if err != nil {
+		t.Fatalf("Error encoding test gif: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestSanitizeGIF(t *testing.T) {
+	clean, contentType, err := media.Sanitize(testGIF(t, 8, 6, 3))
+	if err != nil {
+		t.Fatalf("Error sanitizing gif: %s", err)
+	}
+	anim, err := gif.DecodeAll(bytes.NewReader(clean))
+	if err != nil || contentType != "image/gif" || len(anim.Image) != 3 {
+		t.Errorf("Expected a 3 frame gif, got %s (%v)", contentType, err)
+	}
+}
+
+func TestSanitizeGIFTooManyPixels(t *testing.T) {
+	cases := [][]byte{
+		testGIF(t, 2000, 2000, media.MaxPixels/(2000*2000)+1),
+		testGIF(t, 1, 1, media.MaxFrames+1),
+	}
+	for idx, data := range cases {
+		if len(data) > 5<<20 {
+			t.Fatalf("Gif n.%d is %d bytes, over the upload limit", idx, len(data))
+		}
+		_, _, err := media.Sanitize(data)
+		if !errors.Is(err, media.ErrImageTooLarge) {
+			t.Errorf("Gif n.%d: expected ErrImageTooLarge, got %v", idx, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package media_test
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/FG-GIS/boot-dev-chirpy/internal/media"
+)
+
+func TestResize(t *testing.T) {
+	cases := []struct {
+		width, height, maxDim int
+		expW, expH            int
+	}{
+		{800, 600, 150, 150, 112},
+		{600, 800, 150, 112, 150},
+		{100, 50, 150, 100, 50},
+		{3000, 10, 150, 150, 1},
+	}
+	for idx, c := range cases {
+		src := image.NewRGBA(image.Rect(0, 0, c.width, c.height))
+		dst := media.Resize(src, c.maxDim)
+		if dst.Bounds().Dx() != c.expW || dst.Bounds().Dy() != c.expH {
+			t.Errorf("Case n.%d: expected %dx%d, got %dx%d\n", idx, c.expW, c.expH, dst.Bounds().Dx(), dst.Bounds().Dy())
+		}
+	}
+}
+
+func TestResizeAverages(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 4; y++ {
+			if (x+y)%2 == 0 {
+				src.Set(x, y, color.RGBA{200, 100, 0, 255})
+			} else {
+				src.Set(x, y, color.RGBA{0, 100, 200, 255})
+			}
+		}
+	}
+	dst := media.Resize(src, 2)
+	got := dst.RGBAAt(0, 0)
+	if got != (color.RGBA{100, 100, 100, 255}) {
+		t.Errorf("Expected averaged pixel {100 100 100 255}, got %v\n", got)
+	}
+}
+
+func TestBlurhashSolidColor(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 16, 12))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 12; y++ {
+			src.Set(x, y, color.RGBA{255, 0, 0, 255})
+		}
+	}
+	hash := media.Blurhash(src, 4, 3)
+	// size flag + max AC + 4 chars of DC + 2 chars for each of the 11 ACs
+	if len(hash) != 28 {
+		t.Errorf("Expected a 28 chars hash, got %d [%s]\n", len(hash), hash)
+	}
+	if !strings.HasPrefix(hash, "L") {
+		t.Errorf("Expected a 4x3 size flag, got %s\n", hash)
+	}
+	// DC component is the average colour, 0xFF0000 in base83
+	if hash[2:6] != "TI:j" {
+		t.Errorf("Expected red DC component TI:j, got %s\n", hash[2:6])
+	}
+}
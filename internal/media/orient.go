@@ -0,0 +1,107 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// exifOrientation returns the orientation tag (1 to 8) stored in the Exif
+// block of a jpeg, or 1 when the file carries none.
+func exifOrientation(data []byte) int {
+	idx := 2
+	for idx+4 <= len(data) && data[idx] == 0xFF {
+		marker := data[idx+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		length := int(data[idx+2])<<8 | int(data[idx+3])
+		if length < 2 || idx+2+length > len(data) {
+			break
+		}
+		segment := data[idx+4 : idx+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		idx += 2 + length
+	}
+	return 1
+}
+
+// tiffOrientation looks up tag 0x0112 in the first IFD of a TIFF header.
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	count := int(order.Uint16(tiff[ifd:]))
+	for n := 0; n < count; n++ {
+		entry := ifd + 2 + n*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) != 0x0112 || order.Uint16(tiff[entry+2:]) != 3 {
+			continue
+		}
+		orientation := int(order.Uint16(tiff[entry+8:]))
+		if orientation < 1 || orientation > 8 {
+			return 1
+		}
+		return orientation
+	}
+	return 1
+}
+
+// orient rotates and flips img so that it displays upright once the Exif
+// orientation tag is dropped.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	src := image.NewRGBA(image.Rect(0, 0, srcW, srcH))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	dstW, dstH := srcW, srcH
+	if orientation >= 5 {
+		dstW, dstH = srcH, srcW
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		for x := 0; x < dstW; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = srcW-1-x, y
+			case 3:
+				sx, sy = srcW-1-x, srcH-1-y
+			case 4:
+				sx, sy = x, srcH-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, srcH-1-x
+			case 7:
+				sx, sy = srcW-1-y, srcH-1-x
+			case 8:
+				sx, sy = srcW-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,87 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+)
+
+// Resize scales src down so that its longest side is at most maxDim,
+// averaging the source pixels covered by each destination pixel. Images
+// already within maxDim are copied at their original size.
+func Resize(src image.Image, maxDim int) *image.RGBA {
+	bounds := src.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+	dstW, dstH := fitWithin(srcW, srcH, maxDim)
+
+	rgba := image.NewRGBA(image.Rect(0, 0, srcW, srcH))
+	draw.Draw(rgba, rgba.Bounds(), src, bounds.Min, draw.Src)
+	if dstW == srcW && dstH == srcH {
+		return rgba
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dstW, dstH))
+	for y := 0; y < dstH; y++ {
+		y0 := y * srcH / dstH
+		y1 := max((y+1)*srcH/dstH, y0+1)
+		for x := 0; x < dstW; x++ {
+			x0 := x * srcW / dstW
+			x1 := max((x+1)*srcW/dstW, x0+1)
+			var r, g, b, a, n uint32
+			for sy := y0; sy < y1; sy++ {
+				row := rgba.Pix[sy*rgba.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					px := row[sx*4 : sx*4+4]
+					r += uint32(px[0])
+					g += uint32(px[1])
+					b += uint32(px[2])
+					a += uint32(px[3])
+					n++
+				}
+			}
+			off := y*dst.Stride + x*4
+			dst.Pix[off] = uint8(r / n)
+			dst.Pix[off+1] = uint8(g / n)
+			dst.Pix[off+2] = uint8(b / n)
+			dst.Pix[off+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+func fitWithin(width, height, maxDim int) (int, int) {
+	if width <= maxDim && height <= maxDim {
+		return width, height
+	}
+	if width >= height {
+		return maxDim, max(height*maxDim/width, 1)
+	}
+	return max(width*maxDim/height, 1), maxDim
+}
+
+// Variant is a resized copy generated for every upload.
+type Variant struct {
+	Name   string
+	MaxDim int
+}
+
+// Variants lists the sizes clients can pick from, smallest first.
+var Variants = []Variant{
+	{Name: "thumbnail", MaxDim: 150},
+	{Name: "medium", MaxDim: 600},
+}
+
+// EncodeVariant encodes a resized image for an original of contentType.
+// Jpegs stay jpegs, everything else becomes a png since gif palettes do not
+// survive resampling.
+func EncodeVariant(img image.Image, contentType string) ([]byte, string, error) {
+	out := bytes.Buffer{}
+	if contentType == "image/jpeg" {
+		err := jpeg.Encode(&out, img, &jpeg.Options{Quality: 85})
+		return out.Bytes(), contentType, err
+	}
+	err := png.Encode(&out, img)
+	return out.Bytes(), "image/png", err
+}
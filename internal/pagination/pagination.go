@@ -0,0 +1,73 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Cursor marks the position of the last item of a page, ordered by
+// (created_at, id).
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (c Cursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeCursor(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("Error, malformed cursor.")
+	}
+	tsPart, idPart, found := strings.Cut(string(raw), "|")
+	if !found {
+		return Cursor{}, fmt.Errorf("Error, malformed cursor.")
+	}
+	ts, err := time.Parse(time.RFC3339Nano, tsPart)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("Error, malformed cursor timestamp: %s", err)
+	}
+	id, err := uuid.Parse(idPart)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("Error, malformed cursor id: %s", err)
+	}
+	return Cursor{CreatedAt: ts, ID: id}, nil
+}
+
+// ParseLimit reads a page size from a query string value, falling back to
+// def when empty and rejecting values outside 1..max.
+func ParseLimit(raw string, def, max int) (int, error) {
+	if raw == "" {
+		return def, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("Error, limit must be a number: %s", err)
+	}
+	if limit < 1 || limit > max {
+		return 0, fmt.Errorf("Error, limit must be between 1 and %d.", max)
+	}
+	return limit, nil
+}
+
+func ParseOffset(raw string) (int, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	offset, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("Error, offset must be a number: %s", err)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("Error, offset can't be negative.")
+	}
+	return offset, nil
+}
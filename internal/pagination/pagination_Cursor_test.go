@@ -0,0 +1,70 @@
+package pagination_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FG-GIS/boot-dev-chirpy/internal/pagination"
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	cur := pagination.Cursor{
+		CreatedAt: time.Date(2025, 3, 14, 15, 9, 26, 535897000, time.UTC),
+		ID:        uuid.New(),
+	}
+	decoded, err := pagination.DecodeCursor(cur.Encode())
+	if err != nil {
+		t.Errorf("Error decoding cursor: %s", err)
+	}
+	if !decoded.CreatedAt.Equal(cur.CreatedAt) {
+		t.Errorf("Expected %v, got %v\n", cur.CreatedAt, decoded.CreatedAt)
+	}
+	if decoded.ID != cur.ID {
+		t.Errorf("Expected %v, got %v\n", cur.ID, decoded.ID)
+	}
+}
+
+func TestCursorDecodeFail(t *testing.T) {
+	cursorSlice := []string{"not-base64!", "bm9waXBl", "MjAyNXxub3QtYS11dWlk"}
+	for idx, raw := range cursorSlice {
+		_, err := pagination.DecodeCursor(raw)
+		if err == nil {
+			t.Errorf("Cursor n.%d [%s] did not error out", idx, raw)
+		}
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	limit, err := pagination.ParseLimit("", 20, 100)
+	if err != nil || limit != 20 {
+		t.Errorf("Expected default 20, got %d (%v)", limit, err)
+	}
+	limit, err = pagination.ParseLimit("50", 20, 100)
+	if err != nil || limit != 50 {
+		t.Errorf("Expected 50, got %d (%v)", limit, err)
+	}
+	for _, raw := range []string{"0", "101", "-3", "ten"} {
+		_, err := pagination.ParseLimit(raw, 20, 100)
+		if err == nil {
+			t.Errorf("Limit [%s] did not error out", raw)
+		}
+	}
+}
+
+func TestParseOffset(t *testing.T) {
+	offset, err := pagination.ParseOffset("")
+	if err != nil || offset != 0 {
+		t.Errorf("Expected default 0, got %d (%v)", offset, err)
+	}
+	offset, err = pagination.ParseOffset("40")
+	if err != nil || offset != 40 {
+		t.Errorf("Expected 40, got %d (%v)", offset, err)
+	}
+	for _, raw := range []string{"-1", "forty"} {
+		_, err := pagination.ParseOffset(raw)
+		if err == nil {
+			t.Errorf("Offset [%s] did not error out", raw)
+		}
+	}
+}
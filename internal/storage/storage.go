@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// Storage is where uploaded media ends up. Keys are flat names generated by
+// the server, e.g. "<uuid>.jpg".
+type Storage interface {
+	Put(ctx context.Context, key, contentType string, data io.Reader) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	URL(key string) string
+}
+
+var keyRegex = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func validKey(key string) error {
+	if !keyRegex.MatchString(key) {
+		return fmt.Errorf("Error, invalid storage key: %q", key)
+	}
+	return nil
+}
+
+// LocalStorage keeps files in a directory on disk, served by the app
+// under BaseURL.
+type LocalStorage struct {
+	Root    string
+	BaseURL string
+}
+
+func NewLocalStorage(root, baseURL string) (*LocalStorage, error) {
+	err := os.MkdirAll(root, 0o755)
+	if err != nil {
+		return nil, err
+	}
+	return &LocalStorage{Root: root, BaseURL: baseURL}, nil
+}
+
+func (ls *LocalStorage) Put(ctx context.Context, key, contentType string, data io.Reader) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(ls.Root, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(ls.Root, key))
+}
+
+func (ls *LocalStorage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	if err := validKey(key); err != nil {
+		return nil, err
+	}
+	return os.Open(filepath.Join(ls.Root, key))
+}
+
+func (ls *LocalStorage) Delete(ctx context.Context, key string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(ls.Root, key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+func (ls *LocalStorage) URL(key string) string {
+	u, err := url.JoinPath(ls.BaseURL, key)
+	if err != nil {
+		return ls.BaseURL + key
+	}
+	return u
+}
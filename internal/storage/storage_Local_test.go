@@ -0,0 +1,62 @@
+package storage_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/FG-GIS/boot-dev-chirpy/internal/storage"
+)
+
+func TestLocalPutDelete(t *testing.T) {
+	root := t.TempDir()
+	ls, err := storage.NewLocalStorage(root, "/media/")
+	if err != nil {
+		t.Fatalf("Error creating local storage: %s", err)
+	}
+	err = ls.Put(context.Background(), "test.png", "image/png", strings.NewReader("data"))
+	if err != nil {
+		t.Errorf("Error storing file: %s", err)
+	}
+	content, err := os.ReadFile(filepath.Join(root, "test.png"))
+	if err != nil || string(content) != "data" {
+		t.Errorf("Expected stored content [data], got [%s] (%v)", content, err)
+	}
+	rc, err := ls.Get(context.Background(), "test.png")
+	if err != nil {
+		t.Errorf("Error reading file: %s", err)
+	} else {
+		content, _ = io.ReadAll(rc)
+		rc.Close()
+		if string(content) != "data" {
+			t.Errorf("Expected read content [data], got [%s]", content)
+		}
+	}
+	if u := ls.URL("test.png"); u != "/media/test.png" {
+		t.Errorf("Expected /media/test.png, got %s\n", u)
+	}
+	err = ls.Delete(context.Background(), "test.png")
+	if err != nil {
+		t.Errorf("Error deleting file: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "test.png")); !os.IsNotExist(err) {
+		t.Errorf("File still present after delete: %v", err)
+	}
+}
+
+func TestLocalPutFail(t *testing.T) {
+	ls, err := storage.NewLocalStorage(t.TempDir(), "/media/")
+	if err != nil {
+		t.Fatalf("Error creating local storage: %s", err)
+	}
+	keySlice := []string{"../escape.png", "", "dir/file.png", ".hidden"}
+	for idx, key := range keySlice {
+		err := ls.Put(context.Background(), key, "image/png", strings.NewReader("data"))
+		if err == nil {
+			t.Errorf("Key n.%d [%s] did not error out", idx, key)
+		}
+	}
+}
@@ -1,52 +1,266 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"net/mail"
+	"net/url"
 	"os"
+	"path/filepath"
 	"slices"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/FG-GIS/boot-dev-chirpy/internal/auth"
+	"github.com/FG-GIS/boot-dev-chirpy/internal/chirptext"
 	"github.com/FG-GIS/boot-dev-chirpy/internal/database"
+	"github.com/FG-GIS/boot-dev-chirpy/internal/mailer"
+	"github.com/FG-GIS/boot-dev-chirpy/internal/media"
+	"github.com/FG-GIS/boot-dev-chirpy/internal/pagination"
+	"github.com/FG-GIS/boot-dev-chirpy/internal/storage"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type apiConfig struct {
 	fileserverHits atomic.Int32
+	db             *sql.DB
 	dbQueries      *database.Queries
 	platform       string
 	tknSecret      string
+	// serve GET /api/chirps as a plain, unpaginated array
+	legacyChirpList bool
+	editWindow      time.Duration
+	// how long soft deleted chirps can be restored before being purged
+	retention time.Duration
+	storage   storage.Storage
+	// wakes the media worker after an upload
+	mediaQueue chan struct{}
+	mailer     mailer.Mailer
+	// emails waiting for a password reset token
+	resetQueue chan string
+	// keep accounts with an unverified email from chirping
+	requireVerifiedEmail bool
 }
 
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+
+	maxChirpLength = 140
+	maxChirpMedia  = 4
+	minPollOptions = 2
+	maxPollOptions = 4
+	maxUploadSize  = 5 << 20
+
+	mediaSweepInterval = 10 * time.Minute
+	mediaBatchSize     = 10
+	mediaMaxAttempts   = 5
+	mediaClaimLease    = 15 * time.Minute
+
+	defaultEditWindow = 15 * time.Minute
+
+	defaultRetentionDays = 30
+	purgeInterval        = time.Hour
+
+	scheduleInterval  = 30 * time.Second
+	scheduleBatchSize = 100
+
+	maxChirpLifetime    = 7 * 24 * time.Hour
+	expirySweepInterval = time.Minute
+
+	defaultTrendingWindow = 24 * time.Hour
+	maxTrendingWindow     = 7 * 24 * time.Hour
+
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxLocationLength    = 30
+	maxWebsiteLength     = 100
+
+	verificationTTL        = 24 * time.Hour
+	passwordResetTTL       = 30 * time.Minute
+	passwordResetCooldown  = 5 * time.Minute
+	passwordResetQueueSize = 64
+)
+
 type User struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	Email        string    `json:"email"`
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	Handle        string    `json:"handle"`
+	EmailVerified bool      `json:"email_verified"`
+	Token         string    `json:"token"`
+	RefreshToken  string    `json:"refresh_token"`
+}
+
+// userProfile is the public view of a user, safe to show to anyone.
+type userProfile struct {
+	ID             uuid.UUID `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	Handle         string    `json:"handle"`
+	DisplayName    string    `json:"display_name"`
+	Bio            string    `json:"bio"`
+	AvatarURL      string    `json:"avatar_url,omitempty"`
+	Location       string    `json:"location"`
+	Website        string    `json:"website"`
+	ChirpCount     int64     `json:"chirp_count"`
+	FollowerCount  int64     `json:"follower_count"`
+	FollowingCount int64     `json:"following_count"`
 }
 
 type validChirp struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	CleansedBody string    `json:"body"`
-	UserID       uuid.UUID `json:"user_id"`
+	ID           uuid.UUID      `json:"id"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	CleansedBody string         `json:"body"`
+	UserID       uuid.UUID      `json:"user_id"`
+	InReplyTo    *uuid.UUID     `json:"in_reply_to"`
+	Tombstone    bool           `json:"tombstone,omitempty"`
+	Pinned       bool           `json:"pinned,omitempty"`
+	Scheduled    bool           `json:"scheduled,omitempty"`
+	PublishAt    *time.Time     `json:"publish_at,omitempty"`
+	ExpiresAt    *time.Time     `json:"expires_at"`
+	Visibility   string         `json:"visibility"`
+	LikeCount    int64          `json:"like_count"`
+	LikedByMe    *bool          `json:"liked_by_me,omitempty"`
+	RefChirpID   *uuid.UUID     `json:"ref_chirp_id,omitempty"`
+	RefKind      string         `json:"ref_kind,omitempty"`
+	Original     *validChirp    `json:"original,omitempty"`
+	Media        []chirpMedia   `json:"media,omitempty"`
+	Poll         *chirpPoll     `json:"poll,omitempty"`
+	Mentions     []chirpMention `json:"mentions,omitempty"`
+}
+
+// chirpMention locates a resolved @handle in the body by byte offsets.
+type chirpMention struct {
+	UserID uuid.UUID `json:"user_id"`
+	Handle string    `json:"handle"`
+	Start  int32     `json:"start"`
+	End    int32     `json:"end"`
+}
+
+// chirpPoll leaves out the tallies until the viewer has voted or the poll
+// has closed, so early results do not sway anyone.
+type chirpPoll struct {
+	ClosesAt    time.Time    `json:"closes_at"`
+	Closed      bool         `json:"closed"`
+	VotedOption *uuid.UUID   `json:"voted_option,omitempty"`
+	Options     []pollOption `json:"options"`
+}
+
+type pollOption struct {
+	ID    uuid.UUID `json:"id"`
+	Body  string    `json:"body"`
+	Votes *int64    `json:"votes,omitempty"`
+}
+
+type pollInput struct {
+	Options  []string  `json:"options"`
+	ClosesAt time.Time `json:"closes_at"`
+}
+
+type chirpMedia struct {
+	ID          uuid.UUID      `json:"id"`
+	URL         string         `json:"url"`
+	ContentType string         `json:"content_type"`
+	Width       int32          `json:"width"`
+	Height      int32          `json:"height"`
+	Blurhash    string         `json:"blurhash,omitempty"`
+	Variants    []mediaVariant `json:"variants,omitempty"`
+}
+
+type mediaVariant struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Width  int32  `json:"width"`
+	Height int32  `json:"height"`
+}
+
+// chirpRequest is the body of POST /api/chirps.
+type chirpRequest struct {
+	Body      string      `json:"body"`
+	InReplyTo *uuid.UUID  `json:"in_reply_to"`
+	MediaIDs  []uuid.UUID `json:"media_ids"`
+	Poll      *pollInput  `json:"poll"`
+	PublishAt *time.Time  `json:"publish_at"`
+	// lifetime in seconds, counted from publication
+	ExpiresIn  *int   `json:"expires_in"`
+	Visibility string `json:"visibility"`
+}
+
+// chirpInput is everything storeChirp needs to create a chirp.
+type chirpInput struct {
+	database.CreateChirpParams
+	MediaIDs []uuid.UUID
+	Poll     *pollInput
+	// the draft being published, removed along with the insert
+	DraftID uuid.NullUUID
+}
+
+type chirpDraft struct {
+	ID        uuid.UUID   `json:"id"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
+	Body      string      `json:"body"`
+	InReplyTo *uuid.UUID  `json:"in_reply_to"`
+	MediaIDs  []uuid.UUID `json:"media_ids"`
+}
+
+type draftRequest struct {
+	Body      string      `json:"body"`
+	InReplyTo *uuid.UUID  `json:"in_reply_to"`
+	MediaIDs  []uuid.UUID `json:"media_ids"`
+}
+
+type chirpPage struct {
+	Chirps     []validChirp `json:"chirps"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+type searchResult struct {
+	validChirp
+	Rank float32 `json:"rank"`
+	// escaped HTML, with matches wrapped in <mark>
+	Highlight string `json:"highlight"`
+}
+
+type searchPage struct {
+	Results    []searchResult `json:"results"`
+	NextOffset int            `json:"next_offset,omitempty"`
+}
+
+type chirpThread struct {
+	Chirp      validChirp   `json:"chirp"`
+	Ancestors  []validChirp `json:"ancestors"`
+	Replies    []validChirp `json:"replies"`
+	NextCursor string       `json:"next_cursor,omitempty"`
+}
+
+type followEntry struct {
+	UserID     uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type followPage struct {
+	Users      []followEntry `json:"users"`
+	NextCursor string        `json:"next_cursor,omitempty"`
 }
 
 type userData struct {
 	Password string `json:"password"`
 	Email    string `json:"email"`
+	Handle   string `json:"handle"`
 	// ExpirationTime int    `json:"expires_in_seconds"`
 }
 
@@ -104,6 +318,233 @@ func respondWithJSON(w http.ResponseWriter, code int, payload any) {
 	}
 }
 
+func chirpFromDB(chi database.Chirp) validChirp {
+	vChirp := validChirp{
+		ID:           chi.ID,
+		CreatedAt:    chi.CreatedAt,
+		UpdatedAt:    chi.UpdatedAt,
+		CleansedBody: chi.Body,
+		UserID:       chi.UserID,
+		Tombstone:    chi.TombstonedAt.Valid || chi.DeletedAt.Valid,
+		Visibility:   string(chi.Visibility),
+	}
+	// An expired chirp waiting for the purge job reads as deleted.
+	if chi.ExpiresAt.Valid && !chi.ExpiresAt.Time.After(time.Now()) {
+		vChirp.Tombstone = true
+	}
+	if vChirp.Tombstone {
+		vChirp.CleansedBody = ""
+	}
+	if chi.InReplyTo.Valid {
+		vChirp.InReplyTo = &chi.InReplyTo.UUID
+	}
+	if chi.RefChirpID.Valid {
+		vChirp.RefChirpID = &chi.RefChirpID.UUID
+		vChirp.RefKind = chi.RefKind.String
+	}
+	if chi.Status == "scheduled" {
+		vChirp.Scheduled = true
+		vChirp.PublishAt = &chi.PublishAt.Time
+	}
+	if chi.ExpiresAt.Valid {
+		vChirp.ExpiresAt = &chi.ExpiresAt.Time
+	}
+	return vChirp
+}
+
+// decorateChirps embeds the originals of rechirps and quotes and fills in
+// the engagement counters and media of every chirp in the given slices,
+// with one aggregated query each. LikedByMe is only set when viewerID
+// belongs to an authenticated caller.
+func (cfg *apiConfig) decorateChirps(ctx context.Context, viewerID uuid.UUID, chirpSlices ...[]validChirp) error {
+	refIDs := []uuid.UUID{}
+	for _, chirps := range chirpSlices {
+		for _, chi := range chirps {
+			if chi.RefChirpID != nil {
+				refIDs = append(refIDs, *chi.RefChirpID)
+			}
+		}
+	}
+	originals := map[uuid.UUID]*validChirp{}
+	if len(refIDs) > 0 {
+		rawOriginals, err := cfg.dbQueries.GetChirpsByIDs(ctx, refIDs)
+		if err != nil {
+			return err
+		}
+		origSlice := make([]validChirp, 0, len(rawOriginals))
+		for _, chi := range rawOriginals {
+			origSlice = append(origSlice, chirpFromDB(chi))
+		}
+		for idx := range origSlice {
+			originals[origSlice[idx].ID] = &origSlice[idx]
+		}
+		chirpSlices = append(chirpSlices, origSlice)
+	}
+
+	byID := map[uuid.UUID][]*validChirp{}
+	ids := []uuid.UUID{}
+	for _, chirps := range chirpSlices {
+		for idx := range chirps {
+			chi := &chirps[idx]
+			if _, ok := byID[chi.ID]; !ok {
+				ids = append(ids, chi.ID)
+			}
+			byID[chi.ID] = append(byID[chi.ID], chi)
+			if viewerID != uuid.Nil {
+				likedByMe := false
+				chi.LikedByMe = &likedByMe
+			}
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	stats, err := cfg.dbQueries.GetLikeStats(ctx, database.GetLikeStatsParams{
+		ViewerID: viewerID,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+	for _, stat := range stats {
+		for _, chi := range byID[stat.ChirpID] {
+			chi.LikeCount = stat.LikeCount
+			if chi.LikedByMe != nil {
+				*chi.LikedByMe = stat.LikedByMe
+			}
+		}
+	}
+	attachments, err := cfg.dbQueries.GetMediaForChirps(ctx, ids)
+	if err != nil {
+		return err
+	}
+	mediaIDs := make([]uuid.UUID, 0, len(attachments))
+	for _, att := range attachments {
+		mediaIDs = append(mediaIDs, att.ID)
+	}
+	variants := map[uuid.UUID][]mediaVariant{}
+	if len(mediaIDs) > 0 {
+		rows, err := cfg.dbQueries.GetVariantsForMedia(ctx, mediaIDs)
+		if err != nil {
+			return err
+		}
+		for _, v := range rows {
+			variants[v.MediaID] = append(variants[v.MediaID], mediaVariant{
+				Name:   v.Name,
+				URL:    cfg.storage.URL(v.StorageKey),
+				Width:  v.Width,
+				Height: v.Height,
+			})
+		}
+	}
+	for _, att := range attachments {
+		for _, chi := range byID[att.ChirpID] {
+			if chi.Tombstone {
+				continue
+			}
+			chi.Media = append(chi.Media, chirpMedia{
+				ID:          att.ID,
+				URL:         cfg.storage.URL(att.StorageKey),
+				ContentType: att.ContentType,
+				Width:       att.Width,
+				Height:      att.Height,
+				Blurhash:    att.Blurhash.String,
+				Variants:    variants[att.ID],
+			})
+		}
+	}
+	err = cfg.attachPolls(ctx, viewerID, ids, byID)
+	if err != nil {
+		return err
+	}
+	mentions, err := cfg.dbQueries.GetMentionsForChirps(ctx, ids)
+	if err != nil {
+		return err
+	}
+	for _, mention := range mentions {
+		for _, chi := range byID[mention.ChirpID] {
+			if chi.Tombstone {
+				continue
+			}
+			chi.Mentions = append(chi.Mentions, chirpMention{
+				UserID: mention.UserID,
+				Handle: mention.Handle,
+				Start:  mention.StartOffset,
+				End:    mention.EndOffset,
+			})
+		}
+	}
+	for _, chirps := range chirpSlices {
+		for idx := range chirps {
+			if chirps[idx].RefChirpID != nil {
+				chirps[idx].Original = originals[*chirps[idx].RefChirpID]
+			}
+		}
+	}
+	return nil
+}
+
+func (cfg *apiConfig) attachPolls(ctx context.Context, viewerID uuid.UUID, ids []uuid.UUID, byID map[uuid.UUID][]*validChirp) error {
+	polls, err := cfg.dbQueries.GetPollsForChirps(ctx, ids)
+	if err != nil || len(polls) == 0 {
+		return err
+	}
+	options, err := cfg.dbQueries.GetPollOptionsForChirps(ctx, database.GetPollOptionsForChirpsParams{
+		ViewerID: viewerID,
+		ChirpIds: ids,
+	})
+	if err != nil {
+		return err
+	}
+	byPoll := map[uuid.UUID]*chirpPoll{}
+	for _, poll := range polls {
+		byPoll[poll.ChirpID] = &chirpPoll{
+			ClosesAt: poll.ClosesAt,
+			Closed:   !poll.ClosesAt.After(time.Now()),
+		}
+	}
+	for _, opt := range options {
+		poll := byPoll[opt.ChirpID]
+		if poll == nil {
+			continue
+		}
+		if opt.VotedByMe {
+			poll.VotedOption = &opt.ID
+		}
+		poll.Options = append(poll.Options, pollOption{
+			ID:    opt.ID,
+			Body:  opt.Body,
+			Votes: &opt.Votes,
+		})
+	}
+	for chirpID, poll := range byPoll {
+		if poll.VotedOption == nil && !poll.Closed {
+			for idx := range poll.Options {
+				poll.Options[idx].Votes = nil
+			}
+		}
+		for _, chi := range byID[chirpID] {
+			if chi.Tombstone {
+				continue
+			}
+			chi.Poll = poll
+		}
+	}
+	return nil
+}
+
+func validateChirpBody(body string) (string, error) {
+	if len([]rune(body)) > maxChirpLength {
+		return "", fmt.Errorf("Chirp is too long.")
+	}
+	return profaneCensor(body), nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
 func profaneCensor(msg string) string {
 	badWords := []string{"kerfuffle", "sharbert", "fornax"}
 	msgSlice := strings.Split(msg, " ")
@@ -130,6 +571,16 @@ func (cfg *apiConfig) validateRefreshToken(h http.Header, cont context.Context)
 	return dbRfrTk, nil
 }
 
+// optionalViewer returns the caller's user ID, or uuid.Nil for anonymous
+// requests and invalid tokens.
+func (cfg *apiConfig) optionalViewer(h http.Header) uuid.UUID {
+	userID, err := cfg.validateAccessToken(h)
+	if err != nil {
+		return uuid.Nil
+	}
+	return userID
+}
+
 func (cfg *apiConfig) validateAccessToken(h http.Header) (uuid.UUID, error) {
 	brToken, err := auth.GetBearerToken(h)
 	if err != nil {
@@ -143,10 +594,6 @@ func (cfg *apiConfig) validateAccessToken(h http.Header) (uuid.UUID, error) {
 }
 
 func (cfg *apiConfig) validationHandler(w http.ResponseWriter, r *http.Request) {
-	type chirp struct {
-		Body string `json:"body"`
-	}
-
 	userID, err := cfg.validateAccessToken(r.Header)
 	if err != nil {
 		respondWithError(w, 401, fmt.Sprintf("Error validating acces token: %s", err))
@@ -154,256 +601,2813 @@ func (cfg *apiConfig) validationHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	decoder := json.NewDecoder(r.Body)
-	message := chirp{}
+	message := chirpRequest{}
 	err = decoder.Decode(&message)
-	code := 200
 	if err != nil {
 		respondWithError(w, 500, fmt.Sprintf("Error decoding the message: %s", err))
 		return
 	}
-	if len([]rune(message.Body)) > 140 {
-		code = 400
-		respondWithError(w, code, "Chirp is too long.")
+	input, code, err := cfg.prepareChirp(r.Context(), userID, message)
+	if err != nil {
+		respondWithError(w, code, err.Error())
 		return
 	}
-	msg := profaneCensor(message.Body)
-	usr, err := cfg.dbQueries.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   msg,
-		UserID: userID,
-	})
+	cfg.createChirp(w, r, input)
+}
+
+// prepareChirp runs every check a new chirp goes through and returns the
+// input for storeChirp, or the status code to answer with.
+func (cfg *apiConfig) prepareChirp(ctx context.Context, userID uuid.UUID, message chirpRequest) (chirpInput, int, error) {
+	err := cfg.checkVerified(ctx, userID)
 	if err != nil {
-		respondWithError(w, 500, fmt.Sprintf("Error creating chirp record: %s", err))
-		return
+		return chirpInput{}, 403, err
 	}
-	respBody := validChirp{
-		ID:           usr.ID,
-		CreatedAt:    usr.CreatedAt,
-		UpdatedAt:    usr.UpdatedAt,
-		CleansedBody: usr.Body,
-		UserID:       usr.UserID,
+	msg, err := validateChirpBody(message.Body)
+	if err != nil {
+		return chirpInput{}, 400, err
 	}
-	code = 201
-
-	respondWithJSON(w, code, respBody)
+	inReplyTo := uuid.NullUUID{}
+	if message.InReplyTo != nil {
+		parent, err := cfg.dbQueries.GetChirpByID(ctx, database.GetChirpByIDParams{
+			ID:       *message.InReplyTo,
+			ViewerID: userID,
+		})
+		if err != nil {
+			return chirpInput{}, 404, fmt.Errorf("Error, the chirp you are replying to was not found.")
+		}
+		inReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
+	err = cfg.checkChirpMedia(ctx, userID, message.MediaIDs)
+	if err != nil {
+		return chirpInput{}, 400, err
+	}
+	params := database.CreateChirpParams{
+		Body:       msg,
+		UserID:     userID,
+		InReplyTo:  inReplyTo,
+		Status:     "published",
+		Visibility: database.ChirpVisibilityPublic,
+	}
+	switch visibility := database.ChirpVisibility(message.Visibility); visibility {
+	case "":
+	case database.ChirpVisibilityPublic, database.ChirpVisibilityFollowers, database.ChirpVisibilityMentioned:
+		params.Visibility = visibility
+	default:
+		return chirpInput{}, 400, fmt.Errorf("visibility must be one of public, followers or mentioned.")
+	}
+	// a publish_at in the past just publishes right away
+	if message.PublishAt != nil && message.PublishAt.After(time.Now()) {
+		params.Status = "scheduled"
+		params.PublishAt = sql.NullTime{Time: *message.PublishAt, Valid: true}
+	}
+	if message.ExpiresIn != nil {
+		lifetime := time.Duration(*message.ExpiresIn) * time.Second
+		if lifetime <= 0 || lifetime > maxChirpLifetime {
+			return chirpInput{}, 400, fmt.Errorf("expires_in must be between 1 and %d seconds.", int(maxChirpLifetime.Seconds()))
+		}
+		start := time.Now()
+		if params.PublishAt.Valid {
+			start = params.PublishAt.Time
+		}
+		params.ExpiresAt = sql.NullTime{Time: start.Add(lifetime), Valid: true}
+	}
+	if message.Poll != nil {
+		err = validatePoll(message.Poll)
+		if err != nil {
+			return chirpInput{}, 400, err
+		}
+		if params.PublishAt.Valid && !message.Poll.ClosesAt.After(params.PublishAt.Time) {
+			return chirpInput{}, 400, fmt.Errorf("The poll closing time must be after publish_at.")
+		}
+	}
+	return chirpInput{
+		CreateChirpParams: params,
+		MediaIDs:          message.MediaIDs,
+		Poll:              message.Poll,
+	}, 0, nil
 }
 
-func (cfg *apiConfig) addUser(w http.ResponseWriter, r *http.Request) {
-	decoder := json.NewDecoder(r.Body)
-	usrData := userData{}
-	err := decoder.Decode(&usrData)
+// createChirp stores a prepared chirp and answers with it.
+func (cfg *apiConfig) createChirp(w http.ResponseWriter, r *http.Request, input chirpInput) {
+	usr, err := cfg.storeChirp(r.Context(), input)
 	if err != nil {
-		respondWithError(w, 500, fmt.Sprintf("Error decoding message: %s", err))
+		respondWithError(w, 500, fmt.Sprintf("Error creating chirp record: %s", err))
 		return
 	}
-
-	hashP, err := auth.HashPassword(usrData.Password)
+	respBody := []validChirp{chirpFromDB(usr)}
+	err = cfg.decorateChirps(r.Context(), input.UserID, respBody)
 	if err != nil {
-		respondWithError(w, 400, fmt.Sprintf("Error hashing password: %s", err))
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirp details: %v", err))
 		return
 	}
+	respondWithJSON(w, 201, respBody[0])
+}
 
-	dbUser, err := cfg.dbQueries.CreateUser(r.Context(), database.CreateUserParams{
-		Email:          usrData.Email,
-		HashedPassword: hashP,
-	})
-	if err != nil {
-		respondWithError(w, 400, fmt.Sprintf("Error creating user: %s", err))
-		return
+// validatePoll applies the chirp body rules to every option, censoring
+// them in place.
+func validatePoll(poll *pollInput) error {
+	if len(poll.Options) < minPollOptions || len(poll.Options) > maxPollOptions {
+		return fmt.Errorf("A poll needs between %d and %d options.", minPollOptions, maxPollOptions)
 	}
-	user := User{
-		ID:        dbUser.ID,
-		CreatedAt: dbUser.CreatedAt,
-		UpdatedAt: dbUser.UpdatedAt,
-		Email:     dbUser.Email,
+	if !poll.ClosesAt.After(time.Now()) {
+		return fmt.Errorf("The poll closing time must be in the future.")
 	}
-	respondWithJSON(w, 201, user)
+	for idx, option := range poll.Options {
+		if strings.TrimSpace(option) == "" {
+			return fmt.Errorf("Poll option %d is empty.", idx+1)
+		}
+		clean, err := validateChirpBody(option)
+		if err != nil {
+			return err
+		}
+		poll.Options[idx] = clean
+	}
+	return nil
 }
 
-func (cfg *apiConfig) getChirps(w http.ResponseWriter, r *http.Request) {
-	rawChirpSlice, err := cfg.dbQueries.GetChirps(r.Context())
-	chirps := []validChirp{}
+// checkChirpMedia makes sure a chirp only references media its author
+// uploaded, without duplicates and within the attachment limit.
+func (cfg *apiConfig) checkChirpMedia(ctx context.Context, userID uuid.UUID, mediaIDs []uuid.UUID) error {
+	if len(mediaIDs) == 0 {
+		return nil
+	}
+	if len(mediaIDs) > maxChirpMedia {
+		return fmt.Errorf("A chirp can have at most %d media attachments.", maxChirpMedia)
+	}
+	uploads, err := cfg.dbQueries.GetMediaByIDs(ctx, mediaIDs)
 	if err != nil {
-		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirps from database: %v", err))
-		return
+		return fmt.Errorf("Error retrieving media: %s", err)
 	}
-	for _, chi := range rawChirpSlice {
-		chirps = append(chirps, validChirp{
-			ID:           chi.ID,
-			CreatedAt:    chi.CreatedAt,
-			UpdatedAt:    chi.UpdatedAt,
-			CleansedBody: chi.Body,
-			UserID:       chi.UserID,
-		})
+	owned := map[uuid.UUID]bool{}
+	for _, upload := range uploads {
+		owned[upload.ID] = upload.UserID == userID
 	}
-	respondWithJSON(w, 200, chirps)
+	seen := map[uuid.UUID]bool{}
+	for _, id := range mediaIDs {
+		if !owned[id] {
+			return fmt.Errorf("Media %s not found.", id)
+		}
+		if seen[id] {
+			return fmt.Errorf("Media %s attached more than once.", id)
+		}
+		seen[id] = true
+	}
+	return nil
 }
 
-func (cfg *apiConfig) getChirpById(w http.ResponseWriter, r *http.Request) {
-	id, err := uuid.Parse(r.PathValue("chirpID"))
+// storeChirp creates the chirp and links its hashtags and media in a single
+// transaction.
+func (cfg *apiConfig) storeChirp(ctx context.Context, input chirpInput) (database.Chirp, error) {
+	tx, err := cfg.db.BeginTx(ctx, nil)
 	if err != nil {
-		respondWithError(w, 500, fmt.Sprintf("Error converting chirp ID: %s", err))
-		return
+		return database.Chirp{}, err
 	}
-	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), id)
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+	chirp, err := qtx.CreateChirp(ctx, input.CreateChirpParams)
 	if err != nil {
-		respondWithError(w, 404, fmt.Sprintf("Error chirp not found: %s", err))
-		return
+		return database.Chirp{}, err
 	}
-	vChirp := validChirp{
-		ID:           chirp.ID,
-		CreatedAt:    chirp.CreatedAt,
-		UpdatedAt:    chirp.UpdatedAt,
-		CleansedBody: chirp.Body,
-		UserID:       chirp.UserID,
+	err = linkHashtags(ctx, qtx, chirp)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	err = linkMentions(ctx, qtx, chirp)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	for position, mediaID := range input.MediaIDs {
+		err = qtx.AddChirpMedia(ctx, database.AddChirpMediaParams{
+			ChirpID:  chirp.ID,
+			MediaID:  mediaID,
+			Position: int32(position),
+		})
+		if err != nil {
+			return database.Chirp{}, fmt.Errorf("Error attaching media %s: %s", mediaID, err)
+		}
+	}
+	if input.Poll != nil {
+		err = qtx.CreatePoll(ctx, database.CreatePollParams{
+			ChirpID:  chirp.ID,
+			ClosesAt: input.Poll.ClosesAt,
+		})
+		if err != nil {
+			return database.Chirp{}, fmt.Errorf("Error creating poll: %s", err)
+		}
+		for position, option := range input.Poll.Options {
+			err = qtx.CreatePollOption(ctx, database.CreatePollOptionParams{
+				ChirpID:  chirp.ID,
+				Position: int32(position),
+				Body:     option,
+			})
+			if err != nil {
+				return database.Chirp{}, fmt.Errorf("Error creating poll option: %s", err)
+			}
+		}
+	}
+	if input.DraftID.Valid {
+		removed, err := qtx.DeleteDraft(ctx, database.DeleteDraftParams{
+			ID:     input.DraftID.UUID,
+			UserID: input.UserID,
+		})
+		if err != nil {
+			return database.Chirp{}, fmt.Errorf("Error removing draft: %s", err)
+		}
+		// published concurrently by another request
+		if removed == 0 {
+			return database.Chirp{}, fmt.Errorf("Error, draft %s not found.", input.DraftID.UUID)
+		}
 	}
-	respondWithJSON(w, 200, vChirp)
+	return chirp, tx.Commit()
 }
 
-func (cfg *apiConfig) userLogin(w http.ResponseWriter, r *http.Request) {
-	decoder := json.NewDecoder(r.Body)
-	usrData := userData{}
-	err := decoder.Decode(&usrData)
+func linkHashtags(ctx context.Context, qtx *database.Queries, chirp database.Chirp) error {
+	for _, tag := range chirptext.ExtractHashtags(chirp.Body) {
+		hashtag, err := qtx.UpsertHashtag(ctx, tag)
+		if err != nil {
+			return fmt.Errorf("Error storing hashtag %s: %s", tag, err)
+		}
+		err = qtx.AddChirpHashtag(ctx, database.AddChirpHashtagParams{
+			ChirpID:   chirp.ID,
+			HashtagID: hashtag.ID,
+		})
+		if err != nil {
+			return fmt.Errorf("Error linking hashtag %s: %s", tag, err)
+		}
+	}
+	return nil
+}
+
+// linkMentions stores the @handles of a chirp that resolve to a user and
+// notifies them. Scheduled chirps notify once they are published.
+func linkMentions(ctx context.Context, qtx *database.Queries, chirp database.Chirp) error {
+	mentions := chirptext.ExtractMentions(chirp.Body)
+	if len(mentions) == 0 {
+		return nil
+	}
+	handles := make([]string, 0, len(mentions))
+	for _, mention := range mentions {
+		handles = append(handles, mention.Handle)
+	}
+	users, err := qtx.GetUsersByHandles(ctx, handles)
 	if err != nil {
-		respondWithError(w, 500, fmt.Sprintf("Error decoding message: %s", err))
-		return
+		return fmt.Errorf("Error resolving mentions: %s", err)
 	}
-	usr, err := cfg.dbQueries.GetUserByMail(r.Context(), usrData.Email)
+	byHandle := map[string]uuid.UUID{}
+	for _, user := range users {
+		byHandle[user.Handle] = user.ID
+	}
+	for _, mention := range mentions {
+		userID, ok := byHandle[mention.Handle]
+		if !ok {
+			continue
+		}
+		err = qtx.AddChirpMention(ctx, database.AddChirpMentionParams{
+			ChirpID:     chirp.ID,
+			UserID:      userID,
+			StartOffset: int32(mention.Start),
+			EndOffset:   int32(mention.End),
+		})
+		if err != nil {
+			return fmt.Errorf("Error storing mention of @%s: %s", mention.Handle, err)
+		}
+	}
+	err = qtx.CreateMentionNotifications(ctx, chirp.ID)
 	if err != nil {
-		respondWithError(w, 401, "Incorrect email or password")
-		return
+		return fmt.Errorf("Error creating mention notifications: %s", err)
 	}
-	check, err := auth.CheckPasswordHash(usrData.Password, usr.HashedPassword)
+	return nil
+}
+
+// editChirp stores the current body as a revision before replacing it.
+func (cfg *apiConfig) editChirp(w http.ResponseWriter, r *http.Request) {
+	type chirp struct {
+		Body string `json:"body"`
+	}
+	userID, err := cfg.validateAccessToken(r.Header)
 	if err != nil {
-		respondWithError(w, 401, "Incorrect email or password")
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
 		return
 	}
-	if !check {
-		respondWithError(w, 401, "Incorrect email or password")
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting chirp ID: %s", err))
 		return
 	}
-	rfrToken, err := auth.MakeRefreshToken()
+	message := chirp{}
+	err = json.NewDecoder(r.Body).Decode(&message)
 	if err != nil {
-		respondWithError(w, 500, fmt.Sprintf("Server error, creating refresh token: %s", err))
+		respondWithError(w, 400, fmt.Sprintf("Error decoding the message: %s", err))
 		return
 	}
-	rfrTokenEntry, err := cfg.dbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-		Token:  rfrToken,
-		UserID: usr.ID,
+	current, err := cfg.dbQueries.GetChirpByID(r.Context(), database.GetChirpByIDParams{
+		ID:       id,
+		ViewerID: userID,
 	})
 	if err != nil {
-		respondWithError(w, 500, fmt.Sprintf("Server error, creating refresh token: %s", err))
+		respondWithError(w, 404, "Error chirp not found.")
 		return
 	}
-	tkn, err := auth.MakeJWT(usr.ID, cfg.tknSecret, 1*time.Hour)
-	usrResponse := User{
-		ID:           usr.ID,
-		CreatedAt:    usr.CreatedAt,
-		UpdatedAt:    usr.UpdatedAt,
-		Email:        usr.Email,
-		Token:        tkn,
-		RefreshToken: rfrTokenEntry.Token,
+	if current.UserID != userID {
+		respondWithError(w, 403, "Forbidden")
+		return
 	}
-	respondWithJSON(w, 200, usrResponse)
-}
-
-func (cfg *apiConfig) TkHandlerRefresh(w http.ResponseWriter, r *http.Request) {
-	type token struct {
-		Tk string `json:"token"`
+	if current.RefKind.String == "rechirp" {
+		respondWithError(w, 400, "Rechirps can't be edited.")
+		return
 	}
-	dbRfrTk, err := cfg.validateRefreshToken(r.Header, r.Context())
-	if err != nil {
-		respondWithError(w, 401, fmt.Sprintf("Error with the refresh token: %s", err))
+	if time.Since(current.CreatedAt) > cfg.editWindow {
+		respondWithError(w, 403, fmt.Sprintf("Chirps can only be edited within %s of posting.", cfg.editWindow))
 		return
 	}
-	dbUsr, err := cfg.dbQueries.GetUserFromRefreshToken(r.Context(), dbRfrTk.Token)
+	msg, err := validateChirpBody(message.Body)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Database error: %s", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+	_, err = qtx.CreateChirpRevision(r.Context(), database.CreateChirpRevisionParams{
+		ChirpID:   current.ID,
+		Body:      current.Body,
+		CreatedAt: current.UpdatedAt,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error storing chirp revision: %s", err))
+		return
+	}
+	updated, err := qtx.UpdateChirpBody(r.Context(), database.UpdateChirpBodyParams{
+		ID:   current.ID,
+		Body: msg,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error updating chirp: %s", err))
+		return
+	}
+	err = qtx.DeleteChirpHashtags(r.Context(), updated.ID)
+	if err == nil {
+		err = linkHashtags(r.Context(), qtx, updated)
+	}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error updating hashtags: %s", err))
+		return
+	}
+	// users mentioned before the edit are not notified twice
+	err = qtx.DeleteChirpMentions(r.Context(), updated.ID)
+	if err == nil {
+		err = linkMentions(r.Context(), qtx, updated)
+	}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error updating mentions: %s", err))
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Database error: %s", err))
+		return
+	}
+
+	chirps := []validChirp{chirpFromDB(updated)}
+	err = cfg.decorateChirps(r.Context(), userID, chirps)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirp details: %v", err))
+		return
+	}
+	respondWithJSON(w, 200, chirps[0])
+}
+
+func (cfg *apiConfig) getChirpRevisions(w http.ResponseWriter, r *http.Request) {
+	type revision struct {
+		Body       string    `json:"body"`
+		CreatedAt  time.Time `json:"created_at"`
+		ReplacedAt time.Time `json:"replaced_at"`
+	}
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting chirp ID: %s", err))
+		return
+	}
+	viewerID := cfg.optionalViewer(r.Header)
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), database.GetChirpByIDParams{
+		ID:       id,
+		ViewerID: viewerID,
+	})
+	if err != nil {
+		respondWithError(w, 404, "Error chirp not found.")
+		return
+	}
+	rawRevisions, err := cfg.dbQueries.GetChirpRevisions(r.Context(), chirp.ID)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirp revisions: %v", err))
+		return
+	}
+	revisions := []revision{}
+	for _, rev := range rawRevisions {
+		revisions = append(revisions, revision{
+			Body:       rev.Body,
+			CreatedAt:  rev.CreatedAt,
+			ReplacedAt: rev.ReplacedAt,
+		})
+	}
+	respondWithJSON(w, 200, revisions)
+}
+
+// uploadMedia accepts a single image in the "file" field of a multipart
+// form. The image is re-encoded before storing, so no metadata survives.
+func (cfg *apiConfig) uploadMedia(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize+(1<<20))
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error reading upload: %s", err))
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxUploadSize+1))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error reading upload: %s", err))
+		return
+	}
+	if len(data) > maxUploadSize {
+		respondWithError(w, 413, fmt.Sprintf("Upload exceeds %d bytes.", maxUploadSize))
+		return
+	}
+	clean, contentType, err := media.Sanitize(data)
+	if errors.Is(err, media.ErrUnsupportedType) {
+		respondWithError(w, 415, "Unsupported media type, expected jpeg, png or gif.")
+		return
+	}
+	if errors.Is(err, media.ErrImageTooLarge) {
+		respondWithError(w, 413, fmt.Sprintf("Image exceeds %dx%d, %d pixels or %d frames.", media.MaxDimension, media.MaxDimension, media.MaxPixels, media.MaxFrames))
+		return
+	}
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	width, height, err := media.Dimensions(clean)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error reading image size: %s", err))
+		return
+	}
+	key := uuid.NewString() + media.Extension(contentType)
+	err = cfg.storage.Put(r.Context(), key, contentType, bytes.NewReader(clean))
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error storing upload: %s", err))
+		return
+	}
+	upload, err := cfg.dbQueries.CreateMedia(r.Context(), database.CreateMediaParams{
+		UserID:      userID,
+		ContentType: contentType,
+		StorageKey:  key,
+		SizeBytes:   int64(len(clean)),
+		Width:       int32(width),
+		Height:      int32(height),
+	})
+	if err != nil {
+		cfg.storage.Delete(r.Context(), key)
+		respondWithError(w, 500, fmt.Sprintf("Error creating media record: %s", err))
+		return
+	}
+	select {
+	case cfg.mediaQueue <- struct{}{}:
+	default:
+	}
+	respondWithJSON(w, 201, chirpMedia{
+		ID:          upload.ID,
+		URL:         cfg.storage.URL(upload.StorageKey),
+		ContentType: upload.ContentType,
+		Width:       upload.Width,
+		Height:      upload.Height,
+	})
+}
+
+// processMedia generates the resized variants and blurhash of new uploads.
+// It runs on every wake up from uploadMedia and on a timer, so uploads
+// missed because of a restart or a failure are picked up again. Uploads are
+// claimed in batches, so several instances never work on the same one, and
+// an upload that failed is retried once its claim goes stale, up to
+// mediaMaxAttempts times.
+func (cfg *apiConfig) processMedia(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		for {
+			pending, err := cfg.dbQueries.ClaimUnprocessedMedia(ctx, database.ClaimUnprocessedMediaParams{
+				MaxAttempts: mediaMaxAttempts,
+				StaleBefore: time.Now().Add(-mediaClaimLease),
+				BatchSize:   mediaBatchSize,
+			})
+			if err != nil {
+				log.Printf("Error claiming unprocessed media: %s\n", err)
+				break
+			}
+			for _, upload := range pending {
+				err := cfg.generateVariants(ctx, upload)
+				if err != nil {
+					log.Printf("Error processing media %s (attempt %d): %s\n", upload.ID, upload.Attempts, err)
+				}
+			}
+			if len(pending) < mediaBatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-cfg.mediaQueue:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) generateVariants(ctx context.Context, upload database.Medium) error {
+	rc, err := cfg.storage.Get(ctx, upload.StorageKey)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	img, err := media.Decode(data)
+	if err != nil {
+		return err
+	}
+	for _, v := range media.Variants {
+		resized := media.Resize(img, v.MaxDim)
+		data, contentType, err := media.EncodeVariant(resized, upload.ContentType)
+		if err != nil {
+			return err
+		}
+		key := fmt.Sprintf("%s_%s%s", upload.ID, v.Name, media.Extension(contentType))
+		err = cfg.storage.Put(ctx, key, contentType, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		err = cfg.dbQueries.CreateMediaVariant(ctx, database.CreateMediaVariantParams{
+			MediaID:    upload.ID,
+			Name:       v.Name,
+			StorageKey: key,
+			Width:      int32(resized.Bounds().Dx()),
+			Height:     int32(resized.Bounds().Dy()),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	hash := media.Blurhash(media.Resize(img, 32), 4, 3)
+	return cfg.dbQueries.SetMediaProcessed(ctx, database.SetMediaProcessedParams{
+		ID:       upload.ID,
+		Blurhash: sql.NullString{String: hash, Valid: true},
+	})
+}
+
+func (cfg *apiConfig) addUser(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	usrData := userData{}
+	err := decoder.Decode(&usrData)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error decoding message: %s", err))
+		return
+	}
+
+	err = validateEmail(usrData.Email)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	handle := usrData.Handle
+	if handle == "" {
+		handle = generateHandle()
+	}
+	err = chirptext.ValidateHandle(handle)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	hashP, err := auth.HashPassword(usrData.Password)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error hashing password: %s", err))
+		return
+	}
+
+	dbUser, err := cfg.dbQueries.CreateUser(r.Context(), database.CreateUserParams{
+		Email:          usrData.Email,
+		HashedPassword: hashP,
+		Handle:         handle,
+	})
+	if isUniqueViolation(err) {
+		respondWithError(w, 409, "Error, email or handle already taken.")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error creating user: %s", err))
+		return
+	}
+	err = cfg.sendVerification(r.Context(), dbUser.ID, dbUser.Email)
+	if err != nil {
+		log.Printf("Error sending verification email to user %s: %s\n", dbUser.ID, err)
+	}
+	user := User{
+		ID:        dbUser.ID,
+		CreatedAt: dbUser.CreatedAt,
+		UpdatedAt: dbUser.UpdatedAt,
+		Email:     dbUser.Email,
+		Handle:    dbUser.Handle,
+	}
+	respondWithJSON(w, 201, user)
+}
+
+// validateEmail accepts a bare address only, without a display name.
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return fmt.Errorf("Invalid email address.")
+	}
+	return nil
+}
+
+func (cfg *apiConfig) sendVerification(ctx context.Context, userID uuid.UUID, email string) error {
+	tkn, err := auth.MakeVerificationToken(userID, email, cfg.tknSecret, verificationTTL)
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("Confirm your Chirpy email address by sending this token to POST /api/users/verify:\n\n%s\n\nThe token expires in %s.\n", tkn, verificationTTL)
+	return cfg.mailer.Send(ctx, email, "Confirm your email address", body)
+}
+
+// checkVerified keeps unverified accounts from chirping when
+// REQUIRE_VERIFIED_EMAIL is set.
+func (cfg *apiConfig) checkVerified(ctx context.Context, userID uuid.UUID) error {
+	if !cfg.requireVerifiedEmail {
+		return nil
+	}
+	usr, err := cfg.dbQueries.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !usr.EmailVerifiedAt.Valid {
+		return fmt.Errorf("Verify your email address before chirping.")
+	}
+	return nil
+}
+
+// verifyEmail needs no access token, the signed token names the user. It
+// only works once, and not after the email has changed.
+func (cfg *apiConfig) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	type verification struct {
+		Token string `json:"token"`
+	}
+	message := verification{}
+	err := json.NewDecoder(r.Body).Decode(&message)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error decoding request: %s", err))
+		return
+	}
+	userID, email, err := auth.ValidateVerificationToken(message.Token, cfg.tknSecret)
+	if err != nil {
+		respondWithError(w, 400, "Error, invalid or expired verification token.")
+		return
+	}
+	verified, err := cfg.dbQueries.VerifyEmail(r.Context(), database.VerifyEmailParams{
+		ID:    userID,
+		Email: email,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error verifying email: %s", err))
+		return
+	}
+	if verified == 0 {
+		respondWithError(w, 400, "Error, verification token already used or no longer valid.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) resendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	usr, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, 404, "Error user not found.")
+		return
+	}
+	if usr.EmailVerifiedAt.Valid {
+		respondWithError(w, 409, "Error, email already verified.")
+		return
+	}
+	err = cfg.sendVerification(r.Context(), usr.ID, usr.Email)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error sending verification email: %s", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requestPasswordReset answers right away, the same way whether or not the
+// email belongs to an account, so neither the reply nor its timing give
+// that away. The token is issued by sendPasswordResets; requests arriving
+// while its queue is full are dropped.
+func (cfg *apiConfig) requestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type resetRequest struct {
+		Email string `json:"email"`
+	}
+	message := resetRequest{}
+	err := json.NewDecoder(r.Body).Decode(&message)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error decoding request: %s", err))
+		return
+	}
+	select {
+	case cfg.resetQueue <- message.Email:
+	default:
+		log.Printf("Password reset queue is full, dropping a request\n")
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendPasswordResets issues the reset tokens queued by requestPasswordReset,
+// one at a time, so a flood of requests can't pile up hashing and mail work.
+func (cfg *apiConfig) sendPasswordResets(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case email := <-cfg.resetQueue:
+			err := cfg.issuePasswordReset(ctx, email)
+			if err != nil {
+				log.Printf("Error issuing password reset: %s\n", err)
+			}
+		}
+	}
+}
+
+// issuePasswordReset mails a "<id>.<secret>" token to the owner of email, if
+// any. Only a hash of the secret is stored, and a new token replaces any
+// earlier one. An account gets at most one token per passwordResetCooldown,
+// so repeated requests can't flood its inbox or void the link just sent.
+func (cfg *apiConfig) issuePasswordReset(ctx context.Context, email string) error {
+	usr, err := cfg.dbQueries.GetUserByMail(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	latest, err := cfg.dbQueries.GetLatestPasswordResetTime(ctx, usr.ID)
+	if err == nil && time.Since(latest) < passwordResetCooldown {
+		return nil
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	secret, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+	tokenHash, err := auth.HashPassword(secret)
+	if err != nil {
+		return err
+	}
+	tx, err := cfg.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+	err = qtx.DeletePasswordResets(ctx, usr.ID)
+	if err != nil {
+		return err
+	}
+	reset, err := qtx.CreatePasswordReset(ctx, database.CreatePasswordResetParams{
+		ID:        uuid.New(),
+		UserID:    usr.ID,
+		TokenHash: tokenHash,
+		ExpiresAt: time.Now().Add(passwordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+	body := fmt.Sprintf("Someone asked to reset your Chirpy password. If it was you, send this token with your new password to POST /api/password-reset/confirm:\n\n%s.%s\n\nThe token expires in %s. If it was not you, ignore this email.\n", reset.ID, secret, passwordResetTTL)
+	return cfg.mailer.Send(ctx, usr.Email, "Reset your password", body)
+}
+
+// confirmPasswordReset sets the new password, burns the token and logs the
+// user out everywhere.
+func (cfg *apiConfig) confirmPasswordReset(w http.ResponseWriter, r *http.Request) {
+	type resetConfirm struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	message := resetConfirm{}
+	err := json.NewDecoder(r.Body).Decode(&message)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error decoding request: %s", err))
+		return
+	}
+	if message.Password == "" {
+		respondWithError(w, 400, "Password can't be empty.")
+		return
+	}
+	rawID, secret, _ := strings.Cut(message.Token, ".")
+	resetID, err := uuid.Parse(rawID)
+	if err != nil {
+		respondWithError(w, 400, "Error, invalid or expired reset token.")
+		return
+	}
+	reset, err := cfg.dbQueries.GetPasswordReset(r.Context(), resetID)
+	if err != nil {
+		respondWithError(w, 400, "Error, invalid or expired reset token.")
+		return
+	}
+	check, err := auth.CheckPasswordHash(secret, reset.TokenHash)
+	if err != nil || !check {
+		respondWithError(w, 400, "Error, invalid or expired reset token.")
+		return
+	}
+	newHash, err := auth.HashPassword(message.Password)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Server error: %s", err))
+		return
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Database error: %s", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+	used, err := qtx.UsePasswordReset(r.Context(), reset.ID)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Database error: %s", err))
+		return
+	}
+	// redeemed concurrently by another request
+	if used == 0 {
+		respondWithError(w, 400, "Error, invalid or expired reset token.")
+		return
+	}
+	_, err = qtx.UpdateCredentials(r.Context(), database.UpdateCredentialsParams{
+		ID:             reset.UserID,
+		HashedPassword: sql.NullString{String: newHash, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error updating password: %s", err))
+		return
+	}
+	// no token to keep, every session goes
+	_, err = qtx.RevokeOtherRefreshTokens(r.Context(), database.RevokeOtherRefreshTokensParams{
+		UserID: reset.UserID,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error revoking refresh tokens: %s", err))
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Database error: %s", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// generateHandle gives a placeholder handle to users signing up without
+// one, in the same shape as the handles backfilled for existing accounts.
+func generateHandle() string {
+	return "user_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:10]
+}
+
+// loadProfile only counts the chirps viewerID is allowed to see.
+func (cfg *apiConfig) loadProfile(ctx context.Context, viewerID, userID uuid.UUID) (userProfile, error) {
+	row, err := cfg.dbQueries.GetUserProfile(ctx, database.GetUserProfileParams{
+		ViewerID: viewerID,
+		ID:       userID,
+	})
+	if err != nil {
+		return userProfile{}, err
+	}
+	profile := userProfile{
+		ID:             row.ID,
+		CreatedAt:      row.CreatedAt,
+		Handle:         row.Handle,
+		DisplayName:    row.DisplayName,
+		Bio:            row.Bio,
+		Location:       row.Location,
+		Website:        row.Website,
+		ChirpCount:     row.ChirpCount,
+		FollowerCount:  row.FollowerCount,
+		FollowingCount: row.FollowingCount,
+	}
+	if row.AvatarKey.Valid {
+		profile.AvatarURL = cfg.storage.URL(row.AvatarKey.String)
+	}
+	return profile, nil
+}
+
+func (cfg *apiConfig) getUserProfile(w http.ResponseWriter, r *http.Request) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting user ID: %s", err))
+		return
+	}
+	profile, err := cfg.loadProfile(r.Context(), cfg.optionalViewer(r.Header), userID)
+	if err != nil {
+		respondWithError(w, 404, "Error user not found.")
+		return
+	}
+	respondWithJSON(w, 200, profile)
+}
+
+func (cfg *apiConfig) getUserByHandle(w http.ResponseWriter, r *http.Request) {
+	usr, err := cfg.dbQueries.GetUserByHandle(r.Context(), r.PathValue("handle"))
+	if err != nil {
+		respondWithError(w, 404, "Error user not found.")
+		return
+	}
+	profile, err := cfg.loadProfile(r.Context(), cfg.optionalViewer(r.Header), usr.ID)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving profile: %s", err))
+		return
+	}
+	respondWithJSON(w, 200, profile)
+}
+
+// updateProfile only touches the fields present in the request and rejects
+// any it doesn't know. An empty string clears a field, avatar_media_id
+// included.
+func (cfg *apiConfig) updateProfile(w http.ResponseWriter, r *http.Request) {
+	type profileUpdate struct {
+		DisplayName   *string `json:"display_name"`
+		Bio           *string `json:"bio"`
+		Location      *string `json:"location"`
+		Website       *string `json:"website"`
+		AvatarMediaID *string `json:"avatar_media_id"`
+	}
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	update := profileUpdate{}
+	decoder := json.NewDecoder(r.Body)
+	// account fields belong to PATCH /api/users, so fail loudly instead of
+	// dropping them
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&update)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error decoding request: %s", err))
+		return
+	}
+	params := database.UpdateProfileParams{ID: userID}
+	fields := []struct {
+		name  string
+		value *string
+		max   int
+		dest  *sql.NullString
+	}{
+		{"display_name", update.DisplayName, maxDisplayNameLength, &params.DisplayName},
+		{"bio", update.Bio, maxBioLength, &params.Bio},
+		{"location", update.Location, maxLocationLength, &params.Location},
+		{"website", update.Website, maxWebsiteLength, &params.Website},
+	}
+	for _, field := range fields {
+		if field.value == nil {
+			continue
+		}
+		value := strings.TrimSpace(*field.value)
+		if len([]rune(value)) > field.max {
+			respondWithError(w, 400, fmt.Sprintf("%s can be at most %d characters.", field.name, field.max))
+			return
+		}
+		*field.dest = sql.NullString{String: value, Valid: true}
+	}
+	if params.Website.String != "" {
+		site, err := url.Parse(params.Website.String)
+		if err != nil || (site.Scheme != "http" && site.Scheme != "https") || site.Host == "" {
+			respondWithError(w, 400, "website must be an http or https URL.")
+			return
+		}
+	}
+	if update.AvatarMediaID != nil {
+		params.SetAvatar = true
+		if *update.AvatarMediaID != "" {
+			avatarID, err := uuid.Parse(*update.AvatarMediaID)
+			if err != nil {
+				respondWithError(w, 400, fmt.Sprintf("Error converting avatar media ID: %s", err))
+				return
+			}
+			uploads, err := cfg.dbQueries.GetMediaByIDs(r.Context(), []uuid.UUID{avatarID})
+			if err != nil {
+				respondWithError(w, 500, fmt.Sprintf("Error retrieving media: %s", err))
+				return
+			}
+			if len(uploads) == 0 || uploads[0].UserID != userID {
+				respondWithError(w, 400, fmt.Sprintf("Media %s not found.", avatarID))
+				return
+			}
+			params.AvatarMediaID = uuid.NullUUID{UUID: avatarID, Valid: true}
+		}
+	}
+	err = cfg.dbQueries.UpdateProfile(r.Context(), params)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error updating profile: %s", err))
+		return
+	}
+	profile, err := cfg.loadProfile(r.Context(), userID, userID)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving profile: %s", err))
+		return
+	}
+	respondWithJSON(w, 200, profile)
+}
+
+func (cfg *apiConfig) getChirps(w http.ResponseWriter, r *http.Request) {
+	if cfg.legacyChirpList {
+		cfg.getAllChirps(w, r)
+		return
+	}
+	query := r.URL.Query()
+	limit, err := pagination.ParseLimit(query.Get("limit"), defaultPageSize, maxPageSize)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	params, err := chirpFilters(query)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	params.PageSize = int32(limit + 1)
+	params.ViewerID = cfg.optionalViewer(r.Header)
+	// a profile listing starts with the author's pinned chirp, which is
+	// left out of the pages themselves
+	var pinned *validChirp
+	if params.AuthorID.Valid && !params.Since.Valid && !params.Until.Valid {
+		pin, err := cfg.dbQueries.GetPinnedChirp(r.Context(), database.GetPinnedChirpParams{
+			UserID:   params.AuthorID.UUID,
+			ViewerID: params.ViewerID,
+		})
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, 500, fmt.Sprintf("Error retrieving pinned chirp: %v", err))
+			return
+		}
+		if err == nil {
+			params.ExcludeID = uuid.NullUUID{UUID: pin.ID, Valid: true}
+			if !params.CursorID.Valid {
+				chi := chirpFromDB(pin)
+				chi.Pinned = true
+				pinned = &chi
+			}
+		}
+	}
+	var rawChirpSlice []database.Chirp
+	switch query.Get("sort") {
+	case "", "asc":
+		rawChirpSlice, err = cfg.dbQueries.GetChirpsPage(r.Context(), params)
+	case "desc":
+		rawChirpSlice, err = cfg.dbQueries.GetChirpsPageDesc(r.Context(), database.GetChirpsPageDescParams(params))
+	default:
+		respondWithError(w, 400, "Invalid sort, expected asc or desc.")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirps from database: %v", err))
+		return
+	}
+	page := newChirpPage(rawChirpSlice, limit)
+	if pinned != nil {
+		page.Chirps = append([]validChirp{*pinned}, page.Chirps...)
+	}
+	err = cfg.decorateChirps(r.Context(), params.ViewerID, page.Chirps)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirp details: %v", err))
+		return
+	}
+	respondWithJSON(w, 200, page)
+}
+
+func chirpFilters(query url.Values) (database.GetChirpsPageParams, error) {
+	params := database.GetChirpsPageParams{}
+	if rawAuthor := query.Get("author_id"); rawAuthor != "" {
+		authorID, err := uuid.Parse(rawAuthor)
+		if err != nil {
+			return params, fmt.Errorf("Invalid author_id, expected a UUID: %s", err)
+		}
+		params.AuthorID = uuid.NullUUID{UUID: authorID, Valid: true}
+	}
+	if rawSince := query.Get("since"); rawSince != "" {
+		since, err := time.Parse(time.RFC3339, rawSince)
+		if err != nil {
+			return params, fmt.Errorf("Invalid since, expected an RFC3339 timestamp: %s", err)
+		}
+		params.Since = sql.NullTime{Time: since.UTC(), Valid: true}
+	}
+	if rawUntil := query.Get("until"); rawUntil != "" {
+		until, err := time.Parse(time.RFC3339, rawUntil)
+		if err != nil {
+			return params, fmt.Errorf("Invalid until, expected an RFC3339 timestamp: %s", err)
+		}
+		params.Until = sql.NullTime{Time: until.UTC(), Valid: true}
+	}
+	if params.Since.Valid && params.Until.Valid && !params.Since.Time.Before(params.Until.Time) {
+		return params, fmt.Errorf("Invalid time window, since must be before until.")
+	}
+	var err error
+	params.CursorCreatedAt, params.CursorID, err = parseCursor(query.Get("cursor"))
+	if err != nil {
+		return params, err
+	}
+	return params, nil
+}
+
+func parseCursor(rawCursor string) (sql.NullTime, uuid.NullUUID, error) {
+	if rawCursor == "" {
+		return sql.NullTime{}, uuid.NullUUID{}, nil
+	}
+	cursor, err := pagination.DecodeCursor(rawCursor)
+	if err != nil {
+		return sql.NullTime{}, uuid.NullUUID{}, err
+	}
+	return sql.NullTime{Time: cursor.CreatedAt, Valid: true}, uuid.NullUUID{UUID: cursor.ID, Valid: true}, nil
+}
+
+// newChirpPage trims the extra row fetched past limit and turns it into
+// the cursor for the next page.
+func newChirpPage(rawChirpSlice []database.Chirp, limit int) chirpPage {
+	page := chirpPage{Chirps: []validChirp{}}
+	if len(rawChirpSlice) > limit {
+		rawChirpSlice = rawChirpSlice[:limit]
+		last := rawChirpSlice[limit-1]
+		page.NextCursor = pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	for _, chi := range rawChirpSlice {
+		page.Chirps = append(page.Chirps, chirpFromDB(chi))
+	}
+	return page
+}
+
+func (cfg *apiConfig) getAllChirps(w http.ResponseWriter, r *http.Request) {
+	viewerID := cfg.optionalViewer(r.Header)
+	rawChirpSlice, err := cfg.dbQueries.GetChirps(r.Context(), viewerID)
+	chirps := []validChirp{}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirps from database: %v", err))
+		return
+	}
+	for _, chi := range rawChirpSlice {
+		chirps = append(chirps, chirpFromDB(chi))
+	}
+	err = cfg.decorateChirps(r.Context(), viewerID, chirps)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirp details: %v", err))
+		return
+	}
+	respondWithJSON(w, 200, chirps)
+}
+
+// searchChirps runs a full-text query over the stored bodies, which are
+// already censored, so profane words never match.
+func (cfg *apiConfig) searchChirps(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		respondWithError(w, 400, "Missing search query q.")
+		return
+	}
+	limit, err := pagination.ParseLimit(query.Get("limit"), defaultPageSize, maxPageSize)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	offset, err := pagination.ParseOffset(query.Get("offset"))
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	viewerID := cfg.optionalViewer(r.Header)
+	rows, err := cfg.dbQueries.SearchChirps(r.Context(), database.SearchChirpsParams{
+		Query:      q,
+		ViewerID:   viewerID,
+		PageSize:   int32(limit + 1),
+		PageOffset: int32(offset),
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error searching chirps: %v", err))
+		return
+	}
+	page := searchPage{Results: []searchResult{}}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		page.NextOffset = offset + limit
+	}
+	ids := make([]uuid.UUID, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.ID)
+	}
+	rawChirpSlice, err := cfg.dbQueries.GetChirpsByIDs(r.Context(), ids)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirps from database: %v", err))
+		return
+	}
+	chirpsByID := map[uuid.UUID]validChirp{}
+	for _, chi := range rawChirpSlice {
+		chirpsByID[chi.ID] = chirpFromDB(chi)
+	}
+	// keep the rank order of the search, not the one of the lookup
+	chirps := []validChirp{}
+	for _, row := range rows {
+		if chi, ok := chirpsByID[row.ID]; ok {
+			chirps = append(chirps, chi)
+			page.Results = append(page.Results, searchResult{Rank: row.Rank, Highlight: row.Headline})
+		}
+	}
+	err = cfg.decorateChirps(r.Context(), viewerID, chirps)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirp details: %v", err))
+		return
+	}
+	for idx := range page.Results {
+		page.Results[idx].validChirp = chirps[idx]
+	}
+	respondWithJSON(w, 200, page)
+}
+
+func (cfg *apiConfig) getHashtagChirps(w http.ResponseWriter, r *http.Request) {
+	tag := chirptext.NormalizeTag(r.PathValue("tag"))
+	if tag == "" {
+		respondWithError(w, 400, "Missing hashtag.")
+		return
+	}
+	query := r.URL.Query()
+	limit, err := pagination.ParseLimit(query.Get("limit"), defaultPageSize, maxPageSize)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	viewerID := cfg.optionalViewer(r.Header)
+	params := database.GetChirpsByHashtagParams{
+		Tag:      tag,
+		ViewerID: viewerID,
+		PageSize: int32(limit + 1),
+	}
+	params.CursorCreatedAt, params.CursorID, err = parseCursor(query.Get("cursor"))
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	rawChirpSlice, err := cfg.dbQueries.GetChirpsByHashtag(r.Context(), params)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirps for #%s: %v", tag, err))
+		return
+	}
+	page := newChirpPage(rawChirpSlice, limit)
+	err = cfg.decorateChirps(r.Context(), viewerID, page.Chirps)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirp details: %v", err))
+		return
+	}
+	respondWithJSON(w, 200, page)
+}
+
+func (cfg *apiConfig) getTrendingHashtags(w http.ResponseWriter, r *http.Request) {
+	type trendingTag struct {
+		Tag  string `json:"tag"`
+		Uses int64  `json:"uses"`
+	}
+	query := r.URL.Query()
+	limit, err := pagination.ParseLimit(query.Get("limit"), 10, maxPageSize)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	window := defaultTrendingWindow
+	if rawWindow := query.Get("window"); rawWindow != "" {
+		window, err = time.ParseDuration(rawWindow)
+		if err != nil || window <= 0 || window > maxTrendingWindow {
+			respondWithError(w, 400, fmt.Sprintf("Invalid window, expected a duration up to %s.", maxTrendingWindow))
+			return
+		}
+	}
+	rows, err := cfg.dbQueries.GetTrendingHashtags(r.Context(), database.GetTrendingHashtagsParams{
+		Since:    time.Now().UTC().Add(-window),
+		PageSize: int32(limit),
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving trending hashtags: %v", err))
+		return
+	}
+	trending := []trendingTag{}
+	for _, row := range rows {
+		trending = append(trending, trendingTag{Tag: row.Tag, Uses: row.Uses})
+	}
+	respondWithJSON(w, 200, trending)
+}
+
+// getChirpById answers 404 for chirps the caller may not see, so their
+// existence does not leak.
+func (cfg *apiConfig) getChirpById(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error converting chirp ID: %s", err))
+		return
+	}
+	viewerID := cfg.optionalViewer(r.Header)
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), database.GetChirpByIDParams{
+		ID:       id,
+		ViewerID: viewerID,
+	})
+	if err != nil {
+		respondWithError(w, 404, fmt.Sprintf("Error chirp not found: %s", err))
+		return
+	}
+	chirps := []validChirp{chirpFromDB(chirp)}
+	err = cfg.decorateChirps(r.Context(), viewerID, chirps)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirp details: %v", err))
+		return
+	}
+	respondWithJSON(w, 200, chirps[0])
+}
+
+func (cfg *apiConfig) getChirpThread(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting chirp ID: %s", err))
+		return
+	}
+	query := r.URL.Query()
+	limit, err := pagination.ParseLimit(query.Get("limit"), defaultPageSize, maxPageSize)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	viewerID := cfg.optionalViewer(r.Header)
+	params := database.GetChirpRepliesParams{
+		ChirpID:  id,
+		ViewerID: viewerID,
+		PageSize: int32(limit + 1),
+	}
+	params.CursorCreatedAt, params.CursorID, err = parseCursor(query.Get("cursor"))
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), database.GetChirpByIDParams{
+		ID:       id,
+		ViewerID: viewerID,
+	})
+	if err != nil {
+		respondWithError(w, 404, fmt.Sprintf("Error chirp not found: %s", err))
+		return
+	}
+	ancestors, err := cfg.dbQueries.GetChirpAncestors(r.Context(), database.GetChirpAncestorsParams{
+		ChirpID:  id,
+		ViewerID: viewerID,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving thread ancestors: %v", err))
+		return
+	}
+	replies, err := cfg.dbQueries.GetChirpReplies(r.Context(), params)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving thread replies: %v", err))
+		return
+	}
+	repliesPage := newChirpPage(replies, limit)
+	thread := chirpThread{
+		Chirp:      chirpFromDB(chirp),
+		Ancestors:  []validChirp{},
+		Replies:    repliesPage.Chirps,
+		NextCursor: repliesPage.NextCursor,
+	}
+	for _, chi := range ancestors {
+		thread.Ancestors = append(thread.Ancestors, chirpFromDB(chi))
+	}
+	root := []validChirp{thread.Chirp}
+	err = cfg.decorateChirps(r.Context(), viewerID, root, thread.Ancestors, thread.Replies)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirp details: %v", err))
+		return
+	}
+	thread.Chirp = root[0]
+	respondWithJSON(w, 200, thread)
+}
+
+func (cfg *apiConfig) userLogin(w http.ResponseWriter, r *http.Request) {
+	decoder := json.NewDecoder(r.Body)
+	usrData := userData{}
+	err := decoder.Decode(&usrData)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error decoding message: %s", err))
+		return
+	}
+	usr, err := cfg.dbQueries.GetUserByMail(r.Context(), usrData.Email)
+	if err != nil {
+		respondWithError(w, 401, "Incorrect email or password")
+		return
+	}
+	check, err := auth.CheckPasswordHash(usrData.Password, usr.HashedPassword)
+	if err != nil {
+		respondWithError(w, 401, "Incorrect email or password")
+		return
+	}
+	if !check {
+		respondWithError(w, 401, "Incorrect email or password")
+		return
+	}
+	rfrToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Server error, creating refresh token: %s", err))
+		return
+	}
+	rfrTokenEntry, err := cfg.dbQueries.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+		Token:  rfrToken,
+		UserID: usr.ID,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Server error, creating refresh token: %s", err))
+		return
+	}
+	tkn, err := auth.MakeJWT(usr.ID, cfg.tknSecret, 1*time.Hour)
+	usrResponse := User{
+		ID:            usr.ID,
+		CreatedAt:     usr.CreatedAt,
+		UpdatedAt:     usr.UpdatedAt,
+		Email:         usr.Email,
+		Handle:        usr.Handle,
+		EmailVerified: usr.EmailVerifiedAt.Valid,
+		Token:         tkn,
+		RefreshToken:  rfrTokenEntry.Token,
+	}
+	respondWithJSON(w, 200, usrResponse)
+}
+
+func (cfg *apiConfig) TkHandlerRefresh(w http.ResponseWriter, r *http.Request) {
+	type token struct {
+		Tk string `json:"token"`
+	}
+	dbRfrTk, err := cfg.validateRefreshToken(r.Header, r.Context())
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error with the refresh token: %s", err))
+		return
+	}
+	dbUsr, err := cfg.dbQueries.GetUserFromRefreshToken(r.Context(), dbRfrTk.Token)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Database error: %s", err))
+		return
+	}
+	respToken, err := auth.MakeJWT(dbUsr.ID, cfg.tknSecret, 1*time.Hour)
+	respondWithJSON(w, 200, token{Tk: respToken})
+}
+
+func (cfg *apiConfig) revokeRefreshToken(w http.ResponseWriter, r *http.Request) {
+	dbRfrTk, err := cfg.validateRefreshToken(r.Header, r.Context())
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error with the refresh token: %s", err))
+		return
+	}
+	revokedTk, err := cfg.dbQueries.RevokeRefreshToken(r.Context(), database.RevokeRefreshTokenParams{
+		Token: dbRfrTk.Token,
+		RevokedAt: sql.NullTime{
+			Time:  time.Now(),
+			Valid: true,
+		},
+	})
+	fmt.Printf("Token %s\nRevoked at:%s\n", revokedTk.Token, revokedTk.RevokedAt.Time.String())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// updateUser only changes the fields present in the request and rejects
+// any it doesn't know. Changing the email or password needs the current
+// password. A new password signs the user out everywhere else: it also
+// needs refresh_token, the caller's own live refresh token, which is the
+// only one left unrevoked.
+func (cfg *apiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
+	type userUpdate struct {
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		Handle          *string `json:"handle"`
+		CurrentPassword string  `json:"current_password"`
+		RefreshToken    string  `json:"refresh_token"`
+	}
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	update := userUpdate{}
+	decoder := json.NewDecoder(r.Body)
+	// profile fields belong to PATCH /api/users/me, so fail loudly instead
+	// of dropping them
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&update)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error decoding request: %s", err))
+		return
+	}
+	if update.Password != nil && update.RefreshToken == "" {
+		respondWithError(w, 400, "refresh_token is required to change the password.")
+		return
+	}
+	current, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, 404, "Error user not found.")
+		return
+	}
+	if update.Password != nil {
+		session, err := cfg.dbQueries.GetRefreshToken(r.Context(), update.RefreshToken)
+		if err != nil || session.UserID != userID || session.RevokedAt.Valid || !session.ExpiresAt.After(time.Now()) {
+			respondWithError(w, 401, "Error, refresh_token is not a live session of this user.")
+			return
+		}
+	}
+	params := database.UpdateCredentialsParams{ID: userID}
+	if update.Email != nil && *update.Email != current.Email {
+		err = validateEmail(*update.Email)
+		if err != nil {
+			respondWithError(w, 400, err.Error())
+			return
+		}
+		params.Email = sql.NullString{String: *update.Email, Valid: true}
+	}
+	if update.Password != nil {
+		if *update.Password == "" {
+			respondWithError(w, 400, "Password can't be empty.")
+			return
+		}
+		newHash, err := auth.HashPassword(*update.Password)
+		if err != nil {
+			respondWithError(w, 500, fmt.Sprintf("Server error: %s", err))
+			return
+		}
+		params.HashedPassword = sql.NullString{String: newHash, Valid: true}
+	}
+	if update.Handle != nil {
+		err = chirptext.ValidateHandle(*update.Handle)
+		if err != nil {
+			respondWithError(w, 400, err.Error())
+			return
+		}
+		params.Handle = sql.NullString{String: *update.Handle, Valid: true}
+	}
+	if params.Email.Valid || params.HashedPassword.Valid {
+		check, err := auth.CheckPasswordHash(update.CurrentPassword, current.HashedPassword)
+		if err != nil || !check {
+			respondWithError(w, 401, "Incorrect current password")
+			return
+		}
+	}
+
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Database error: %s", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+	usr, err := qtx.UpdateCredentials(r.Context(), params)
+	if isUniqueViolation(err) {
+		respondWithError(w, 409, "Error, email or handle already taken.")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error updating user: %s", err))
+		return
+	}
+	if params.HashedPassword.Valid {
+		_, err = qtx.RevokeOtherRefreshTokens(r.Context(), database.RevokeOtherRefreshTokensParams{
+			UserID: userID,
+			Token:  update.RefreshToken,
+		})
+		if err != nil {
+			respondWithError(w, 500, fmt.Sprintf("Error revoking refresh tokens: %s", err))
+			return
+		}
+	}
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Database error: %s", err))
+		return
+	}
+	if params.Email.Valid {
+		err = cfg.sendVerification(r.Context(), usr.ID, usr.Email)
+		if err != nil {
+			log.Printf("Error sending verification email to user %s: %s\n", usr.ID, err)
+		}
+	}
+
+	usrResponse := User{
+		ID:            usr.ID,
+		CreatedAt:     usr.CreatedAt,
+		UpdatedAt:     usr.UpdatedAt,
+		Email:         usr.Email,
+		Handle:        usr.Handle,
+		EmailVerified: usr.EmailVerifiedAt.Valid,
+	}
+	respondWithJSON(w, 200, usrResponse)
+}
+
+func (cfg *apiConfig) delChirpById(w http.ResponseWriter, r *http.Request) {
+	tk, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Unauthorized: %s", err))
+		return
+	}
+	usrId, err := auth.ValidateJWT(tk, cfg.tknSecret)
+	if err != nil {
+		respondWithError(w, 403, fmt.Sprintf("Forbidden: %s", err))
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error converting chirp ID: %s", err))
+		return
+	}
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), database.GetChirpByIDParams{
+		ID:       id,
+		ViewerID: usrId,
+	})
+	if err != nil {
+		respondWithError(w, 404, fmt.Sprintf("Error chirp not found: %s", err))
+		return
+	}
+	if chirp.UserID != usrId {
+		respondWithError(w, 403, "Forbidden")
+		return
+	}
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+	err = qtx.SoftDeleteChirp(r.Context(), id)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	err = qtx.DeletePinForChirp(r.Context(), id)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error unpinning chirp: %s", err))
+		return
+	}
+	err = tx.Commit()
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Something went wrong: %s", err))
+		return
+	}
+	w.WriteHeader(204) // http.StatusNoContent
+}
+
+// pinChirp pins one of the caller's chirps to their profile, replacing
+// any previous pin.
+func (cfg *apiConfig) pinChirp(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting chirp ID: %s", err))
+		return
+	}
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), database.GetChirpByIDParams{
+		ID:       id,
+		ViewerID: userID,
+	})
+	if err != nil {
+		respondWithError(w, 404, "Error chirp not found.")
+		return
+	}
+	if chirp.UserID != userID {
+		respondWithError(w, 403, "Error, you can only pin your own chirps.")
+		return
+	}
+	err = cfg.dbQueries.PinChirp(r.Context(), database.PinChirpParams{
+		UserID:  userID,
+		ChirpID: id,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error pinning chirp: %s", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) unpinChirp(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting chirp ID: %s", err))
+		return
+	}
+	removed, err := cfg.dbQueries.UnpinChirp(r.Context(), database.UnpinChirpParams{
+		UserID:  userID,
+		ChirpID: id,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error unpinning chirp: %s", err))
+		return
+	}
+	if removed == 0 {
+		respondWithError(w, 404, "Error, chirp not pinned.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) restoreChirp(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting chirp ID: %s", err))
+		return
+	}
+	chirp, err := cfg.dbQueries.GetChirpByIDWithDeleted(r.Context(), id)
+	if err != nil {
+		respondWithError(w, 404, fmt.Sprintf("Error chirp not found: %s", err))
+		return
+	}
+	if chirp.UserID != userID {
+		usr, err := cfg.dbQueries.GetUserByID(r.Context(), userID)
+		if err != nil || !usr.IsAdmin {
+			respondWithError(w, 403, "Forbidden")
+			return
+		}
+	}
+	if !chirp.DeletedAt.Valid {
+		respondWithError(w, 409, "Error, chirp is not deleted.")
+		return
+	}
+	if chirp.TombstonedAt.Valid || time.Since(chirp.DeletedAt.Time) > cfg.retention {
+		respondWithError(w, 410, "Error, chirp is past its retention period.")
+		return
+	}
+	restored, err := cfg.dbQueries.RestoreChirp(r.Context(), id)
+	if isUniqueViolation(err) {
+		respondWithError(w, 409, "Error, chirp already rechirped.")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error restoring chirp: %s", err))
+		return
+	}
+	chirps := []validChirp{chirpFromDB(restored)}
+	err = cfg.decorateChirps(r.Context(), userID, chirps)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirp details: %v", err))
+		return
+	}
+	respondWithJSON(w, 200, chirps[0])
+}
+
+// getDeletedChirps lists the caller's chirps that can still be restored.
+func (cfg *apiConfig) getDeletedChirps(w http.ResponseWriter, r *http.Request) {
+	type deletedChirp struct {
+		validChirp
+		Body      string    `json:"body"`
+		DeletedAt time.Time `json:"deleted_at"`
+	}
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	rawChirpSlice, err := cfg.dbQueries.GetDeletedChirpsByUser(r.Context(), database.GetDeletedChirpsByUserParams{
+		UserID:       userID,
+		DeletedSince: time.Now().Add(-cfg.retention),
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving deleted chirps: %v", err))
+		return
+	}
+	chirps := []deletedChirp{}
+	for _, chi := range rawChirpSlice {
+		chirps = append(chirps, deletedChirp{
+			validChirp: chirpFromDB(chi),
+			Body:       chi.Body,
+			DeletedAt:  chi.DeletedAt.Time,
+		})
+	}
+	respondWithJSON(w, 200, chirps)
+}
+
+// publishScheduledChirps publishes chirps whose publish_at has passed.
+// Due rows are claimed with FOR UPDATE SKIP LOCKED, so several instances
+// can run it at once without publishing anything twice.
+func (cfg *apiConfig) publishScheduledChirps(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		published, err := cfg.dbQueries.PublishDueChirps(ctx, scheduleBatchSize)
+		if err != nil {
+			log.Printf("Error publishing scheduled chirps: %s\n", err)
+		}
+		if len(published) > 0 {
+			log.Printf("Published %d scheduled chirps\n", len(published))
+		}
+		for _, chirp := range published {
+			err = cfg.dbQueries.CreateMentionNotifications(ctx, chirp.ID)
+			if err != nil {
+				log.Printf("Error notifying mentions of chirp %s: %s\n", chirp.ID, err)
+			}
+		}
+		// a full batch means more may be waiting
+		if len(published) == scheduleBatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) getScheduledChirps(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	rawChirpSlice, err := cfg.dbQueries.GetScheduledChirpsByUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving scheduled chirps: %v", err))
+		return
+	}
+	chirps := []validChirp{}
+	for _, chi := range rawChirpSlice {
+		chirps = append(chirps, chirpFromDB(chi))
+	}
+	err = cfg.decorateChirps(r.Context(), userID, chirps)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirp details: %v", err))
+		return
+	}
+	respondWithJSON(w, 200, chirps)
+}
+
+func (cfg *apiConfig) rescheduleChirp(w http.ResponseWriter, r *http.Request) {
+	type schedule struct {
+		PublishAt time.Time `json:"publish_at"`
+	}
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting chirp ID: %s", err))
+		return
+	}
+	message := schedule{}
+	err = json.NewDecoder(r.Body).Decode(&message)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error decoding the message: %s", err))
+		return
+	}
+	if !message.PublishAt.After(time.Now()) {
+		respondWithError(w, 400, "The new publish_at must be in the future.")
+		return
+	}
+	tx, err := cfg.db.BeginTx(r.Context(), nil)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Database error: %s", err))
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.dbQueries.WithTx(tx)
+	// the owner-scoped update comes first, so the poll of someone else's
+	// chirp is never looked at
+	chirp, err := qtx.RescheduleChirp(r.Context(), database.RescheduleChirpParams{
+		ID:        id,
+		UserID:    userID,
+		PublishAt: sql.NullTime{Time: message.PublishAt, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 404, "Error, no scheduled chirp found.")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error rescheduling chirp: %s", err))
+		return
+	}
+	poll, err := qtx.GetPoll(r.Context(), id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving poll: %s", err))
+		return
+	}
+	if err == nil && !poll.ClosesAt.After(message.PublishAt) {
+		respondWithError(w, 400, "The poll closing time must be after publish_at.")
+		return
+	}
+	err = tx.Commit()
 	if err != nil {
 		respondWithError(w, 500, fmt.Sprintf("Database error: %s", err))
 		return
 	}
-	respToken, err := auth.MakeJWT(dbUsr.ID, cfg.tknSecret, 1*time.Hour)
-	respondWithJSON(w, 200, token{Tk: respToken})
+	chirps := []validChirp{chirpFromDB(chirp)}
+	err = cfg.decorateChirps(r.Context(), userID, chirps)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirp details: %v", err))
+		return
+	}
+	respondWithJSON(w, 200, chirps[0])
+}
+
+// cancelScheduledChirp drops a pending chirp for good, it was never public.
+func (cfg *apiConfig) cancelScheduledChirp(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting chirp ID: %s", err))
+		return
+	}
+	removed, err := cfg.dbQueries.CancelScheduledChirp(r.Context(), database.CancelScheduledChirpParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error cancelling chirp: %s", err))
+		return
+	}
+	if removed == 0 {
+		respondWithError(w, 404, "Error, no scheduled chirp found.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func draftFromDB(d database.Draft) chirpDraft {
+	draft := chirpDraft{
+		ID:        d.ID,
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+		Body:      d.Body,
+		MediaIDs:  d.MediaIds,
+	}
+	if d.InReplyTo.Valid {
+		draft.InReplyTo = &d.InReplyTo.UUID
+	}
+	if draft.MediaIDs == nil {
+		draft.MediaIDs = []uuid.UUID{}
+	}
+	return draft
+}
+
+// decodeDraft reads a draft body. Drafts are only checked for the body
+// length and attachment ownership here, the other chirp rules apply when
+// they get published.
+func (cfg *apiConfig) decodeDraft(r *http.Request, userID uuid.UUID) (draftRequest, error) {
+	message := draftRequest{}
+	err := json.NewDecoder(r.Body).Decode(&message)
+	if err != nil {
+		return message, fmt.Errorf("Error decoding the message: %s", err)
+	}
+	// the body is stored as written, it is only censored when published
+	_, err = validateChirpBody(message.Body)
+	if err != nil {
+		return message, err
+	}
+	err = cfg.checkChirpMedia(r.Context(), userID, message.MediaIDs)
+	if err != nil {
+		return message, err
+	}
+	if message.MediaIDs == nil {
+		message.MediaIDs = []uuid.UUID{}
+	}
+	return message, nil
+}
+
+func (cfg *apiConfig) createDraft(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	message, err := cfg.decodeDraft(r, userID)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	params := database.CreateDraftParams{
+		UserID:   userID,
+		Body:     message.Body,
+		MediaIds: message.MediaIDs,
+	}
+	if message.InReplyTo != nil {
+		params.InReplyTo = uuid.NullUUID{UUID: *message.InReplyTo, Valid: true}
+	}
+	draft, err := cfg.dbQueries.CreateDraft(r.Context(), params)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error creating draft: %s", err))
+		return
+	}
+	respondWithJSON(w, 201, draftFromDB(draft))
+}
+
+func (cfg *apiConfig) getDrafts(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	rawDrafts, err := cfg.dbQueries.GetDraftsByUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving drafts: %v", err))
+		return
+	}
+	drafts := []chirpDraft{}
+	for _, d := range rawDrafts {
+		drafts = append(drafts, draftFromDB(d))
+	}
+	respondWithJSON(w, 200, drafts)
+}
+
+func (cfg *apiConfig) getDraft(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("draftID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting draft ID: %s", err))
+		return
+	}
+	draft, err := cfg.dbQueries.GetDraft(r.Context(), database.GetDraftParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, 404, "Error draft not found.")
+		return
+	}
+	respondWithJSON(w, 200, draftFromDB(draft))
+}
+
+func (cfg *apiConfig) updateDraft(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("draftID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting draft ID: %s", err))
+		return
+	}
+	message, err := cfg.decodeDraft(r, userID)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	params := database.UpdateDraftParams{
+		ID:       id,
+		UserID:   userID,
+		Body:     message.Body,
+		MediaIds: message.MediaIDs,
+	}
+	if message.InReplyTo != nil {
+		params.InReplyTo = uuid.NullUUID{UUID: *message.InReplyTo, Valid: true}
+	}
+	draft, err := cfg.dbQueries.UpdateDraft(r.Context(), params)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, 404, "Error draft not found.")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error updating draft: %s", err))
+		return
+	}
+	respondWithJSON(w, 200, draftFromDB(draft))
+}
+
+func (cfg *apiConfig) deleteDraft(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("draftID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting draft ID: %s", err))
+		return
+	}
+	removed, err := cfg.dbQueries.DeleteDraft(r.Context(), database.DeleteDraftParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error deleting draft: %s", err))
+		return
+	}
+	if removed == 0 {
+		respondWithError(w, 404, "Error draft not found.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publishDraft turns a draft into a chirp through the same checks as
+// POST /api/chirps. The draft is removed in the same transaction.
+func (cfg *apiConfig) publishDraft(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("draftID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting draft ID: %s", err))
+		return
+	}
+	draft, err := cfg.dbQueries.GetDraft(r.Context(), database.GetDraftParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if err != nil {
+		respondWithError(w, 404, "Error draft not found.")
+		return
+	}
+	message := chirpRequest{
+		Body:     draft.Body,
+		MediaIDs: draft.MediaIds,
+	}
+	if draft.InReplyTo.Valid {
+		message.InReplyTo = &draft.InReplyTo.UUID
+	}
+	input, code, err := cfg.prepareChirp(r.Context(), userID, message)
+	if err != nil {
+		respondWithError(w, code, err.Error())
+		return
+	}
+	input.DraftID = uuid.NullUUID{UUID: draft.ID, Valid: true}
+	cfg.createChirp(w, r, input)
+}
+
+// sweepExpiredChirps removes chirps past their expires_at. Read queries
+// already hide them, this only reclaims the rows. Like deleted chirps,
+// expired chirps with replies are kept as tombstones.
+func (cfg *apiConfig) sweepExpiredChirps(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		tombstoned, err := cfg.dbQueries.TombstoneExpiredChirps(ctx)
+		if err != nil {
+			log.Printf("Error tombstoning expired chirps: %s\n", err)
+		}
+		purged, err := cfg.dbQueries.PurgeExpiredChirps(ctx)
+		if err != nil {
+			log.Printf("Error purging expired chirps: %s\n", err)
+		}
+		if tombstoned > 0 || purged > 0 {
+			log.Printf("Purged %d expired chirps, tombstoned %d\n", purged, tombstoned)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// purgeDeletedChirps removes soft deleted chirps past the retention period.
+// Chirps that still have replies are reduced to tombstones instead, so
+// their threads stay connected.
+func (cfg *apiConfig) purgeDeletedChirps(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		cutoff := time.Now().Add(-cfg.retention)
+		tombstoned, err := cfg.dbQueries.TombstoneDeletedChirps(ctx, cutoff)
+		if err != nil {
+			log.Printf("Error tombstoning deleted chirps: %s\n", err)
+		}
+		purged, err := cfg.dbQueries.PurgeDeletedChirps(ctx, cutoff)
+		if err != nil {
+			log.Printf("Error purging deleted chirps: %s\n", err)
+		}
+		if tombstoned > 0 || purged > 0 {
+			log.Printf("Purged %d deleted chirps, tombstoned %d\n", purged, tombstoned)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cfg *apiConfig) likeChirp(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting chirp ID: %s", err))
+		return
+	}
+	_, err = cfg.dbQueries.GetChirpByID(r.Context(), database.GetChirpByIDParams{
+		ID:       id,
+		ViewerID: userID,
+	})
+	if err != nil {
+		respondWithError(w, 404, "Error chirp not found.")
+		return
+	}
+	err = cfg.dbQueries.LikeChirp(r.Context(), database.LikeChirpParams{
+		ChirpID: id,
+		UserID:  userID,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error liking chirp: %s", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) votePoll(w http.ResponseWriter, r *http.Request) {
+	type vote struct {
+		OptionID uuid.UUID `json:"option_id"`
+	}
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting chirp ID: %s", err))
+		return
+	}
+	message := vote{}
+	err = json.NewDecoder(r.Body).Decode(&message)
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error decoding the message: %s", err))
+		return
+	}
+	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), database.GetChirpByIDParams{
+		ID:       id,
+		ViewerID: userID,
+	})
+	if err != nil {
+		respondWithError(w, 404, "Error chirp not found.")
+		return
+	}
+	poll, err := cfg.dbQueries.GetPoll(r.Context(), id)
+	if err != nil {
+		respondWithError(w, 404, "Error, this chirp has no poll.")
+		return
+	}
+	if !poll.ClosesAt.After(time.Now()) {
+		respondWithError(w, 409, "Error, the poll is closed.")
+		return
+	}
+	added, err := cfg.dbQueries.VotePoll(r.Context(), database.VotePollParams{
+		UserID:   userID,
+		OptionID: message.OptionID,
+		ChirpID:  id,
+	})
+	if isUniqueViolation(err) {
+		respondWithError(w, 409, "Error, you already voted in this poll.")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error storing vote: %s", err))
+		return
+	}
+	if added == 0 {
+		respondWithError(w, 400, "Error, option not found in this poll.")
+		return
+	}
+	chirps := []validChirp{chirpFromDB(chirp)}
+	err = cfg.decorateChirps(r.Context(), userID, chirps)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirp details: %v", err))
+		return
+	}
+	respondWithJSON(w, 200, chirps[0])
+}
+
+func (cfg *apiConfig) unlikeChirp(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting chirp ID: %s", err))
+		return
+	}
+	removed, err := cfg.dbQueries.UnlikeChirp(r.Context(), database.UnlikeChirpParams{
+		ChirpID: id,
+		UserID:  userID,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error unliking chirp: %s", err))
+		return
+	}
+	if removed == 0 {
+		respondWithError(w, 404, "Error, chirp not liked.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
 }
 
-func (cfg *apiConfig) revokeRefreshToken(w http.ResponseWriter, r *http.Request) {
-	dbRfrTk, err := cfg.validateRefreshToken(r.Header, r.Context())
+func (cfg *apiConfig) bookmarkChirp(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
 	if err != nil {
-		respondWithError(w, 401, fmt.Sprintf("Error with the refresh token: %s", err))
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
 		return
 	}
-	revokedTk, err := cfg.dbQueries.RevokeRefreshToken(r.Context(), database.RevokeRefreshTokenParams{
-		Token: dbRfrTk.Token,
-		RevokedAt: sql.NullTime{
-			Time:  time.Now(),
-			Valid: true,
-		},
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting chirp ID: %s", err))
+		return
+	}
+	_, err = cfg.dbQueries.GetChirpByID(r.Context(), database.GetChirpByIDParams{
+		ID:       id,
+		ViewerID: userID,
 	})
-	fmt.Printf("Token %s\nRevoked at:%s\n", revokedTk.Token, revokedTk.RevokedAt.Time.String())
+	if err != nil {
+		respondWithError(w, 404, "Error chirp not found.")
+		return
+	}
+	err = cfg.dbQueries.AddBookmark(r.Context(), database.AddBookmarkParams{
+		UserID:  userID,
+		ChirpID: id,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error bookmarking chirp: %s", err))
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func (cfg *apiConfig) updateUser(w http.ResponseWriter, r *http.Request) {
+func (cfg *apiConfig) unbookmarkChirp(w http.ResponseWriter, r *http.Request) {
 	userID, err := cfg.validateAccessToken(r.Header)
 	if err != nil {
 		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
 		return
 	}
-	usrData := userData{}
-	decoder := json.NewDecoder(r.Body)
-	err = decoder.Decode(&usrData)
+	id, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
-		respondWithError(w, 500, fmt.Sprintf("Error decoding request: %s", err))
+		respondWithError(w, 400, fmt.Sprintf("Error converting chirp ID: %s", err))
 		return
 	}
-	newHash, err := auth.HashPassword(usrData.Password)
+	removed, err := cfg.dbQueries.RemoveBookmark(r.Context(), database.RemoveBookmarkParams{
+		UserID:  userID,
+		ChirpID: id,
+	})
 	if err != nil {
-		respondWithError(w, 500, fmt.Sprintf("Server error: %s", err))
+		respondWithError(w, 500, fmt.Sprintf("Error removing bookmark: %s", err))
 		return
 	}
-	usr, err := cfg.dbQueries.UpdateCredentials(r.Context(), database.UpdateCredentialsParams{
-		ID:             userID,
-		Email:          usrData.Email,
-		HashedPassword: newHash,
-	})
+	if removed == 0 {
+		respondWithError(w, 404, "Error, chirp not bookmarked.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
-	usrResponse := User{
-		ID:        usr.ID,
-		CreatedAt: usr.CreatedAt,
-		UpdatedAt: usr.UpdatedAt,
-		Email:     usr.Email,
+// getBookmarks lists the caller's bookmarks, most recently saved first.
+// Chirps that are no longer visible are skipped, and purged ones take
+// their bookmarks with them.
+func (cfg *apiConfig) getBookmarks(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
 	}
-	respondWithJSON(w, 200, usrResponse)
+	query := r.URL.Query()
+	limit, err := pagination.ParseLimit(query.Get("limit"), defaultPageSize, maxPageSize)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	params := database.GetBookmarksParams{
+		UserID:   userID,
+		PageSize: int32(limit + 1),
+	}
+	params.CursorCreatedAt, params.CursorID, err = parseCursor(query.Get("cursor"))
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	rows, err := cfg.dbQueries.GetBookmarks(r.Context(), params)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving bookmarks: %v", err))
+		return
+	}
+	page := chirpPage{Chirps: []validChirp{}}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[limit-1]
+		page.NextCursor = pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ChirpID}.Encode()
+	}
+	ids := make([]uuid.UUID, 0, len(rows))
+	for _, row := range rows {
+		ids = append(ids, row.ChirpID)
+	}
+	rawChirpSlice, err := cfg.dbQueries.GetChirpsByIDs(r.Context(), ids)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving bookmarked chirps: %v", err))
+		return
+	}
+	byID := map[uuid.UUID]database.Chirp{}
+	for _, chi := range rawChirpSlice {
+		byID[chi.ID] = chi
+	}
+	for _, id := range ids {
+		if chi, ok := byID[id]; ok {
+			page.Chirps = append(page.Chirps, chirpFromDB(chi))
+		}
+	}
+	err = cfg.decorateChirps(r.Context(), userID, page.Chirps)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirp details: %v", err))
+		return
+	}
+	respondWithJSON(w, 200, page)
 }
 
-func (cfg *apiConfig) delChirpById(w http.ResponseWriter, r *http.Request) {
-	tk, err := auth.GetBearerToken(r.Header)
+type notification struct {
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	Kind      string     `json:"kind"`
+	ActorID   uuid.UUID  `json:"actor_id"`
+	ChirpID   uuid.UUID  `json:"chirp_id"`
+	ReadAt    *time.Time `json:"read_at"`
+}
+
+func (cfg *apiConfig) getNotifications(w http.ResponseWriter, r *http.Request) {
+	type notificationPage struct {
+		Notifications []notification `json:"notifications"`
+		NextCursor    string         `json:"next_cursor,omitempty"`
+	}
+	userID, err := cfg.validateAccessToken(r.Header)
 	if err != nil {
-		respondWithError(w, 401, fmt.Sprintf("Unauthorized: %s", err))
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
 		return
 	}
-	usrId, err := auth.ValidateJWT(tk, cfg.tknSecret)
+	query := r.URL.Query()
+	limit, err := pagination.ParseLimit(query.Get("limit"), defaultPageSize, maxPageSize)
 	if err != nil {
-		respondWithError(w, 403, fmt.Sprintf("Forbidden: %s", err))
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	params := database.GetNotificationsParams{
+		UserID:   userID,
+		PageSize: int32(limit + 1),
+	}
+	params.CursorCreatedAt, params.CursorID, err = parseCursor(query.Get("cursor"))
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	rows, err := cfg.dbQueries.GetNotifications(r.Context(), params)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving notifications: %v", err))
+		return
+	}
+	page := notificationPage{Notifications: []notification{}}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[limit-1]
+		page.NextCursor = pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+	}
+	for _, row := range rows {
+		n := notification{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt,
+			Kind:      row.Kind,
+			ActorID:   row.ActorID,
+			ChirpID:   row.ChirpID,
+		}
+		if row.ReadAt.Valid {
+			n.ReadAt = &row.ReadAt.Time
+		}
+		page.Notifications = append(page.Notifications, n)
+	}
+	respondWithJSON(w, 200, page)
+}
+
+func (cfg *apiConfig) markNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	_, err = cfg.dbQueries.MarkNotificationsRead(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error updating notifications: %s", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rechirp reposts a chirp. A non-empty body turns it into a quote, which goes
+// through the same checks as a regular chirp.
+func (cfg *apiConfig) rechirp(w http.ResponseWriter, r *http.Request) {
+	type quote struct {
+		Body string `json:"body"`
+	}
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
 		return
 	}
 	id, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
-		respondWithError(w, 500, fmt.Sprintf("Error converting chirp ID: %s", err))
+		respondWithError(w, 400, fmt.Sprintf("Error converting chirp ID: %s", err))
+		return
+	}
+	message := quote{}
+	err = json.NewDecoder(r.Body).Decode(&message)
+	if err != nil && !errors.Is(err, io.EOF) {
+		respondWithError(w, 400, fmt.Sprintf("Error decoding the message: %s", err))
 		return
 	}
-	chirp, err := cfg.dbQueries.GetChirpByID(r.Context(), id)
+	err = cfg.checkVerified(r.Context(), userID)
 	if err != nil {
-		respondWithError(w, 404, fmt.Sprintf("Error chirp not found: %s", err))
+		respondWithError(w, 403, err.Error())
 		return
 	}
-	if chirp.UserID != usrId {
-		respondWithError(w, 403, "Forbidden")
+	original, err := cfg.dbQueries.GetChirpByID(r.Context(), database.GetChirpByIDParams{
+		ID:       id,
+		ViewerID: userID,
+	})
+	if err == nil && original.RefKind.String == "rechirp" && original.RefChirpID.Valid {
+		original, err = cfg.dbQueries.GetChirpByID(r.Context(), database.GetChirpByIDParams{
+			ID:       original.RefChirpID.UUID,
+			ViewerID: userID,
+		})
+	}
+	if err != nil {
+		respondWithError(w, 404, "Error chirp not found.")
+		return
+	}
+	if original.UserID == userID {
+		respondWithError(w, 400, "Error, you can't rechirp your own chirp.")
+		return
+	}
+	// spreading a restricted chirp would widen its audience
+	if original.Visibility != database.ChirpVisibilityPublic {
+		respondWithError(w, 403, "Error, only public chirps can be rechirped.")
+		return
+	}
+	params := database.CreateChirpParams{
+		UserID:     userID,
+		RefChirpID: uuid.NullUUID{UUID: original.ID, Valid: true},
+		RefKind:    sql.NullString{String: "rechirp", Valid: true},
+		Status:     "published",
+		Visibility: database.ChirpVisibilityPublic,
+		// a plain rechirp goes away with its original
+		ExpiresAt: original.ExpiresAt,
+	}
+	if strings.TrimSpace(message.Body) != "" {
+		params.Body, err = validateChirpBody(message.Body)
+		if err != nil {
+			respondWithError(w, 400, err.Error())
+			return
+		}
+		params.RefKind.String = "quote"
+		params.ExpiresAt = sql.NullTime{}
+	}
+	chirp, err := cfg.storeChirp(r.Context(), chirpInput{CreateChirpParams: params})
+	if isUniqueViolation(err) {
+		respondWithError(w, 409, "Error, chirp already rechirped.")
 		return
 	}
-	err = cfg.dbQueries.DeleteChirpByID(r.Context(), id)
 	if err != nil {
-		respondWithError(w, 500, fmt.Sprintf("Something went wrong: %s", err))
+		respondWithError(w, 500, fmt.Sprintf("Error creating chirp record: %s", err))
+		return
 	}
-	w.WriteHeader(204) // http.StatusNoContent
+	chirps := []validChirp{chirpFromDB(chirp)}
+	err = cfg.decorateChirps(r.Context(), userID, chirps)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirp details: %v", err))
+		return
+	}
+	respondWithJSON(w, 201, chirps[0])
+}
+
+func (cfg *apiConfig) undoRechirp(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting chirp ID: %s", err))
+		return
+	}
+	removed, err := cfg.dbQueries.DeleteRechirp(r.Context(), database.DeleteRechirpParams{
+		UserID:     userID,
+		RefChirpID: uuid.NullUUID{UUID: id, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error removing rechirp: %s", err))
+		return
+	}
+	if removed == 0 {
+		respondWithError(w, 404, "Error, chirp not rechirped.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) followUser(w http.ResponseWriter, r *http.Request) {
+	followerID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting user ID: %s", err))
+		return
+	}
+	if followeeID == followerID {
+		respondWithError(w, 400, "Users can't follow themselves.")
+		return
+	}
+	_, err = cfg.dbQueries.GetUserByID(r.Context(), followeeID)
+	if err != nil {
+		respondWithError(w, 404, fmt.Sprintf("Error user not found: %s", err))
+		return
+	}
+	err = cfg.dbQueries.FollowUser(r.Context(), database.FollowUserParams{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error following user: %s", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) unfollowUser(w http.ResponseWriter, r *http.Request) {
+	followerID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	followeeID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting user ID: %s", err))
+		return
+	}
+	removed, err := cfg.dbQueries.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: followerID,
+		FolloweeID: followeeID,
+	})
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error unfollowing user: %s", err))
+		return
+	}
+	if removed == 0 {
+		respondWithError(w, 404, "Error, not following this user.")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getUserRelation serves the followers and following lists, which share a
+// route pattern so that it does not clash with /users/by-handle/{handle}.
+func (cfg *apiConfig) getUserRelation(w http.ResponseWriter, r *http.Request) {
+	switch r.PathValue("relation") {
+	case "followers":
+		cfg.listFollows(w, r, false)
+	case "following":
+		cfg.listFollows(w, r, true)
+	default:
+		respondWithError(w, 404, "Not found")
+	}
+}
+
+func (cfg *apiConfig) listFollows(w http.ResponseWriter, r *http.Request, following bool) {
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithError(w, 400, fmt.Sprintf("Error converting user ID: %s", err))
+		return
+	}
+	query := r.URL.Query()
+	limit, err := pagination.ParseLimit(query.Get("limit"), defaultPageSize, maxPageSize)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	params := database.GetFollowersParams{
+		UserID:   userID,
+		PageSize: int32(limit + 1),
+	}
+	params.CursorCreatedAt, params.CursorID, err = parseCursor(query.Get("cursor"))
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	var rows []database.GetFollowersRow
+	if following {
+		var followingRows []database.GetFollowingRow
+		followingRows, err = cfg.dbQueries.GetFollowing(r.Context(), database.GetFollowingParams(params))
+		for _, row := range followingRows {
+			rows = append(rows, database.GetFollowersRow(row))
+		}
+	} else {
+		rows, err = cfg.dbQueries.GetFollowers(r.Context(), params)
+	}
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving follows: %v", err))
+		return
+	}
+	page := followPage{Users: []followEntry{}}
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[limit-1]
+		page.NextCursor = pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.UserID}.Encode()
+	}
+	for _, row := range rows {
+		page.Users = append(page.Users, followEntry{UserID: row.UserID, FollowedAt: row.CreatedAt})
+	}
+	respondWithJSON(w, 200, page)
+}
+
+func (cfg *apiConfig) getTimeline(w http.ResponseWriter, r *http.Request) {
+	userID, err := cfg.validateAccessToken(r.Header)
+	if err != nil {
+		respondWithError(w, 401, fmt.Sprintf("Error validating access token: %s", err))
+		return
+	}
+	query := r.URL.Query()
+	limit, err := pagination.ParseLimit(query.Get("limit"), defaultPageSize, maxPageSize)
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	params := database.GetTimelineParams{
+		FollowerID: userID,
+		PageSize:   int32(limit + 1),
+	}
+	params.CursorCreatedAt, params.CursorID, err = parseCursor(query.Get("cursor"))
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	rawChirpSlice, err := cfg.dbQueries.GetTimeline(r.Context(), params)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving timeline: %v", err))
+		return
+	}
+	page := newChirpPage(rawChirpSlice, limit)
+	err = cfg.decorateChirps(r.Context(), userID, page.Chirps)
+	if err != nil {
+		respondWithError(w, 500, fmt.Sprintf("Error retrieving chirp details: %v", err))
+		return
+	}
+	respondWithJSON(w, 200, page)
 }
 
 func main() {
@@ -415,10 +3419,78 @@ func main() {
 	}
 
 	apiCfg := apiConfig{
+		db:        db,
 		dbQueries: database.New(db),
 		platform:  os.Getenv("PLATFORM"),
 		tknSecret: os.Getenv("SECRET"),
+
+		legacyChirpList: os.Getenv("CHIRPS_LEGACY_LIST") == "true",
+		editWindow:      defaultEditWindow,
+		retention:       defaultRetentionDays * 24 * time.Hour,
+	}
+	if rawWindow := os.Getenv("CHIRP_EDIT_WINDOW"); rawWindow != "" {
+		apiCfg.editWindow, err = time.ParseDuration(rawWindow)
+		if err != nil {
+			log.Fatalf("Error parsing CHIRP_EDIT_WINDOW: %s", err)
+		}
+	}
+	if rawDays := os.Getenv("CHIRP_RETENTION_DAYS"); rawDays != "" {
+		days, err := strconv.Atoi(rawDays)
+		if err != nil || days < 0 {
+			log.Fatalf("Error parsing CHIRP_RETENTION_DAYS: %s", rawDays)
+		}
+		apiCfg.retention = time.Duration(days) * 24 * time.Hour
+	}
+	mailFrom := os.Getenv("MAIL_FROM")
+	if mailFrom == "" {
+		mailFrom = "chirpy@localhost"
+	}
+	switch os.Getenv("MAILER") {
+	case "smtp":
+		smtpPort := os.Getenv("SMTP_PORT")
+		if smtpPort == "" {
+			smtpPort = "587"
+		}
+		apiCfg.mailer = mailer.NewSMTPMailer(os.Getenv("SMTP_HOST"), smtpPort, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), mailFrom)
+	case "log":
+		// mails carry verification and reset tokens, so they are only
+		// written out in development, to MAIL_LOG_FILE or stdout
+		if apiCfg.platform != "dev" {
+			log.Fatalf("Error, MAILER=log is only allowed with PLATFORM=dev")
+		}
+		out := io.Writer(os.Stdout)
+		if logFile := os.Getenv("MAIL_LOG_FILE"); logFile != "" {
+			out, err = os.OpenFile(logFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+			if err != nil {
+				log.Fatalf("Error opening MAIL_LOG_FILE: %s", err)
+			}
+		}
+		apiCfg.mailer = mailer.NewLogMailer(mailFrom, out)
+	case "":
+		log.Fatalf("Error, MAILER is not set, expected smtp or log")
+	default:
+		log.Fatalf("Error, unknown MAILER: %s", os.Getenv("MAILER"))
 	}
+	apiCfg.requireVerifiedEmail = os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true"
+
+	go apiCfg.purgeDeletedChirps(context.Background(), purgeInterval)
+	go apiCfg.publishScheduledChirps(context.Background(), scheduleInterval)
+	go apiCfg.sweepExpiredChirps(context.Background(), expirySweepInterval)
+
+	mediaDir := os.Getenv("MEDIA_DIR")
+	if mediaDir == "" {
+		mediaDir = "media"
+	}
+	mediaPath := "/media/"
+	apiCfg.storage, err = storage.NewLocalStorage(mediaDir, mediaPath)
+	if err != nil {
+		log.Fatalf("Error preparing media storage: %s", err)
+	}
+	apiCfg.mediaQueue = make(chan struct{}, 1)
+	go apiCfg.processMedia(context.Background(), mediaSweepInterval)
+	apiCfg.resetQueue = make(chan string, passwordResetQueueSize)
+	go apiCfg.sendPasswordResets(context.Background())
+
 	port := "8080"
 	filepathRoot := "/app/"
 	apiPath := "/api"
@@ -426,6 +3498,10 @@ func main() {
 	mux := http.NewServeMux()
 	mux.Handle(filepathRoot, apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(".")))))
 
+	mux.HandleFunc("GET "+mediaPath+"{key}", func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, filepath.Join(mediaDir, filepath.Base(r.PathValue("key"))))
+	})
+
 	mux.HandleFunc("GET "+apiPath+"/healthz", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 		w.WriteHeader(http.StatusOK)
@@ -435,13 +3511,55 @@ func main() {
 	mux.HandleFunc("POST "+adminPath+"/reset", apiCfg.metricsReset)
 	mux.HandleFunc("POST "+apiPath+"/chirps", apiCfg.validationHandler)
 	mux.HandleFunc("GET "+apiPath+"/chirps", apiCfg.getChirps)
+	mux.HandleFunc("GET "+apiPath+"/hashtags/{tag}/chirps", apiCfg.getHashtagChirps)
+	mux.HandleFunc("GET "+apiPath+"/hashtags/trending", apiCfg.getTrendingHashtags)
+	mux.HandleFunc("POST "+apiPath+"/media", apiCfg.uploadMedia)
 	mux.HandleFunc("POST "+apiPath+"/users", apiCfg.addUser)
+	mux.HandleFunc("POST "+apiPath+"/users/verify", apiCfg.verifyEmail)
+	mux.HandleFunc("POST "+apiPath+"/users/verify/resend", apiCfg.resendVerification)
+	mux.HandleFunc("POST "+apiPath+"/password-reset/request", apiCfg.requestPasswordReset)
+	mux.HandleFunc("POST "+apiPath+"/password-reset/confirm", apiCfg.confirmPasswordReset)
 	mux.HandleFunc("GET "+apiPath+"/chirps/{chirpID}", apiCfg.getChirpById)
+	mux.HandleFunc("GET "+apiPath+"/chirps/search", apiCfg.searchChirps)
+	mux.HandleFunc("GET "+apiPath+"/chirps/{chirpID}/thread", apiCfg.getChirpThread)
+	mux.HandleFunc("POST "+apiPath+"/chirps/{chirpID}/like", apiCfg.likeChirp)
+	mux.HandleFunc("DELETE "+apiPath+"/chirps/{chirpID}/like", apiCfg.unlikeChirp)
+	mux.HandleFunc("POST "+apiPath+"/chirps/{chirpID}/bookmark", apiCfg.bookmarkChirp)
+	mux.HandleFunc("DELETE "+apiPath+"/chirps/{chirpID}/bookmark", apiCfg.unbookmarkChirp)
+	mux.HandleFunc("GET "+apiPath+"/bookmarks", apiCfg.getBookmarks)
+	mux.HandleFunc("GET "+apiPath+"/notifications", apiCfg.getNotifications)
+	mux.HandleFunc("POST "+apiPath+"/notifications/read", apiCfg.markNotificationsRead)
+	mux.HandleFunc("POST "+apiPath+"/chirps/{chirpID}/poll/vote", apiCfg.votePoll)
+	mux.HandleFunc("POST "+apiPath+"/chirps/{chirpID}/rechirp", apiCfg.rechirp)
+	mux.HandleFunc("DELETE "+apiPath+"/chirps/{chirpID}/rechirp", apiCfg.undoRechirp)
 	mux.HandleFunc("POST "+apiPath+"/login", apiCfg.userLogin)
 	mux.HandleFunc("POST "+apiPath+"/refresh", apiCfg.TkHandlerRefresh)
 	mux.HandleFunc("POST "+apiPath+"/revoke", apiCfg.revokeRefreshToken)
 	mux.HandleFunc("PUT "+apiPath+"/users", apiCfg.updateUser)
+	mux.HandleFunc("PATCH "+apiPath+"/users", apiCfg.updateUser)
+	mux.HandleFunc("POST "+apiPath+"/users/{userID}/follow", apiCfg.followUser)
+	mux.HandleFunc("DELETE "+apiPath+"/users/{userID}/follow", apiCfg.unfollowUser)
+	mux.HandleFunc("GET "+apiPath+"/users/{userID}/{relation}", apiCfg.getUserRelation)
+	mux.HandleFunc("GET "+apiPath+"/users/by-handle/{handle}", apiCfg.getUserByHandle)
+	mux.HandleFunc("GET "+apiPath+"/users/{userID}", apiCfg.getUserProfile)
+	mux.HandleFunc("PATCH "+apiPath+"/users/me", apiCfg.updateProfile)
+	mux.HandleFunc("GET "+apiPath+"/timeline", apiCfg.getTimeline)
 	mux.HandleFunc("DELETE "+apiPath+"/chirps/{chirpID}", apiCfg.delChirpById)
+	mux.HandleFunc("POST "+apiPath+"/chirps/{chirpID}/pin", apiCfg.pinChirp)
+	mux.HandleFunc("DELETE "+apiPath+"/chirps/{chirpID}/pin", apiCfg.unpinChirp)
+	mux.HandleFunc("PUT "+apiPath+"/chirps/{chirpID}", apiCfg.editChirp)
+	mux.HandleFunc("POST "+apiPath+"/chirps/{chirpID}/restore", apiCfg.restoreChirp)
+	mux.HandleFunc("GET "+apiPath+"/chirps/deleted", apiCfg.getDeletedChirps)
+	mux.HandleFunc("GET "+apiPath+"/chirps/scheduled", apiCfg.getScheduledChirps)
+	mux.HandleFunc("POST "+apiPath+"/drafts", apiCfg.createDraft)
+	mux.HandleFunc("GET "+apiPath+"/drafts", apiCfg.getDrafts)
+	mux.HandleFunc("GET "+apiPath+"/drafts/{draftID}", apiCfg.getDraft)
+	mux.HandleFunc("PUT "+apiPath+"/drafts/{draftID}", apiCfg.updateDraft)
+	mux.HandleFunc("DELETE "+apiPath+"/drafts/{draftID}", apiCfg.deleteDraft)
+	mux.HandleFunc("POST "+apiPath+"/drafts/{draftID}/publish", apiCfg.publishDraft)
+	mux.HandleFunc("PUT "+apiPath+"/chirps/{chirpID}/schedule", apiCfg.rescheduleChirp)
+	mux.HandleFunc("DELETE "+apiPath+"/chirps/{chirpID}/schedule", apiCfg.cancelScheduledChirp)
+	mux.HandleFunc("GET "+apiPath+"/chirps/{chirpID}/revisions", apiCfg.getChirpRevisions)
 
 	server := &http.Server{
 		Handler: mux,
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FG-GIS/boot-dev-chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+// These requests are turned down before the database is reached.
+func TestUpdateUserRejectsBadRequests(t *testing.T) {
+	cfg := apiConfig{tknSecret: "test-secret"}
+	token, err := auth.MakeJWT(uuid.New(), cfg.tknSecret, time.Minute)
+	if err != nil {
+		t.Fatalf("Error making access token: %s", err)
+	}
+	bodySlice := []string{
+		// a password change must name the session that stays signed in
+		`{"password": "new", "current_password": "old"}`,
+		// profile fields go to PATCH /api/users/me
+		`{"bio": "hello"}`,
+	}
+	for idx, body := range bodySlice {
+		req := httptest.NewRequest("PATCH", "/api/users", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		cfg.updateUser(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Body n.%d: expected 400, got %d (%s)", idx, rec.Code, rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,28 @@
+-- name: AddBookmark :exec
+INSERT INTO bookmarks (
+  user_id,
+  chirp_id,
+  created_at
+) VALUES (
+  $1,
+  $2,
+  NOW()
+)
+ON CONFLICT DO NOTHING;
+
+-- name: RemoveBookmark :execrows
+DELETE FROM bookmarks
+WHERE user_id = $1 AND chirp_id = $2;
+
+-- name: GetBookmarks :many
+SELECT bookmarks.chirp_id, bookmarks.created_at FROM bookmarks
+JOIN chirps ON chirps.id = bookmarks.chirp_id
+WHERE bookmarks.user_id = sqlc.arg(user_id)::uuid
+  AND chirps.deleted_at IS NULL
+  AND chirps.status = 'published'
+  AND (chirps.expires_at IS NULL OR chirps.expires_at > NOW())
+  AND chirp_visible_to(chirps, sqlc.arg(user_id)::uuid)
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (bookmarks.created_at, bookmarks.chirp_id) < (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+ORDER BY bookmarks.created_at DESC, bookmarks.chirp_id DESC
+LIMIT sqlc.arg(page_size);
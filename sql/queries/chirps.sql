@@ -4,21 +4,231 @@ INSERT INTO chirps (
   created_at,
   updated_at,
   body,
-  user_id
+  user_id,
+  in_reply_to,
+  ref_chirp_id,
+  ref_kind,
+  status,
+  publish_at,
+  expires_at,
+  visibility
 ) VALUES ( 
   gen_random_uuid(),
   NOW(),
   NOW(),
   $1,
-  $2
+  $2,
+  $3,
+  $4,
+  $5,
+  $6,
+  $7,
+  $8,
+  $9
 )
 RETURNING *;
 
 -- name: GetChirps :many
-SELECT * FROM chirps ORDER BY created_at ASC;
+SELECT * FROM chirps WHERE deleted_at IS NULL AND status = 'published'
+  AND (expires_at IS NULL OR expires_at > NOW())
+  AND chirp_visible_to(chirps, sqlc.arg(viewer_id)::uuid)
+ORDER BY created_at ASC;
 
 -- name: GetChirpByID :one
+SELECT * FROM chirps WHERE id = sqlc.arg(id) AND deleted_at IS NULL AND status = 'published'
+  AND (expires_at IS NULL OR expires_at > NOW())
+  AND chirp_visible_to(chirps, sqlc.arg(viewer_id)::uuid);
+
+-- name: GetChirpByIDWithDeleted :one
 SELECT * FROM chirps WHERE id = $1;
 
--- name: DeleteChirpByID :exec
-DELETE FROM chirps WHERE id = $1;
+-- name: GetChirpsPage :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+  AND status = 'published'
+  AND (expires_at IS NULL OR expires_at > NOW())
+  AND chirp_visible_to(chirps, sqlc.arg(viewer_id)::uuid)
+  AND (sqlc.narg(author_id)::uuid IS NULL OR user_id = sqlc.narg(author_id)::uuid)
+  AND (sqlc.narg(since)::timestamp IS NULL OR created_at >= sqlc.narg(since)::timestamp)
+  AND (sqlc.narg(until)::timestamp IS NULL OR created_at < sqlc.narg(until)::timestamp)
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+  AND (sqlc.narg(exclude_id)::uuid IS NULL OR id <> sqlc.narg(exclude_id)::uuid)
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(page_size);
+
+-- name: GetChirpsPageDesc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+  AND status = 'published'
+  AND (expires_at IS NULL OR expires_at > NOW())
+  AND chirp_visible_to(chirps, sqlc.arg(viewer_id)::uuid)
+  AND (sqlc.narg(author_id)::uuid IS NULL OR user_id = sqlc.narg(author_id)::uuid)
+  AND (sqlc.narg(since)::timestamp IS NULL OR created_at >= sqlc.narg(since)::timestamp)
+  AND (sqlc.narg(until)::timestamp IS NULL OR created_at < sqlc.narg(until)::timestamp)
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+  AND (sqlc.narg(exclude_id)::uuid IS NULL OR id <> sqlc.narg(exclude_id)::uuid)
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: SearchChirps :many
+SELECT
+  chirps.id,
+  ts_rank(chirps.search_vector, query)::real AS rank,
+  -- the body is HTML-escaped so that only the <mark> tags are markup
+  ts_headline('english',
+    REPLACE(REPLACE(REPLACE(REPLACE(REPLACE(chirps.body, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;'),
+    query, 'StartSel=<mark>, StopSel=</mark>')::text AS headline
+FROM chirps, websearch_to_tsquery('english', sqlc.arg(query)::text) query
+WHERE chirps.search_vector @@ query
+  AND chirps.deleted_at IS NULL
+  AND chirps.status = 'published'
+  AND (chirps.expires_at IS NULL OR chirps.expires_at > NOW())
+  AND chirp_visible_to(chirps, sqlc.arg(viewer_id)::uuid)
+ORDER BY rank DESC, chirps.created_at DESC, chirps.id ASC
+LIMIT sqlc.arg(page_size) OFFSET sqlc.arg(page_offset);
+
+-- name: GetChirpAncestors :many
+SELECT * FROM chirps
+WHERE id IN (
+  WITH RECURSIVE ancestors(id, in_reply_to) AS (
+    SELECT parent.id, parent.in_reply_to FROM chirps parent
+    WHERE parent.id = (SELECT child.in_reply_to FROM chirps child WHERE child.id = sqlc.arg(chirp_id)::uuid)
+    UNION ALL
+    SELECT parent.id, parent.in_reply_to FROM chirps parent
+    JOIN ancestors ON parent.id = ancestors.in_reply_to
+  )
+  SELECT ancestors.id FROM ancestors
+)
+  AND chirp_visible_to(chirps, sqlc.arg(viewer_id)::uuid)
+ORDER BY created_at ASC, id ASC;
+
+-- name: GetChirpReplies :many
+SELECT * FROM chirps
+WHERE id IN (
+  WITH RECURSIVE replies(id) AS (
+    SELECT child.id FROM chirps child
+    WHERE child.in_reply_to = sqlc.arg(chirp_id)::uuid
+    UNION ALL
+    SELECT child.id FROM chirps child
+    JOIN replies ON child.in_reply_to = replies.id
+  )
+  SELECT replies.id FROM replies
+)
+  AND (deleted_at IS NULL OR EXISTS (
+    SELECT 1 FROM chirps child WHERE child.in_reply_to = chirps.id
+  ))
+  AND status = 'published'
+  AND (expires_at IS NULL OR expires_at > NOW())
+  AND chirp_visible_to(chirps, sqlc.arg(viewer_id)::uuid)
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at ASC, id ASC
+LIMIT sqlc.arg(page_size);
+
+-- name: GetChirpsByIDs :many
+SELECT * FROM chirps
+WHERE id = ANY(sqlc.arg(ids)::uuid[]);
+
+-- name: DeleteRechirp :execrows
+DELETE FROM chirps
+WHERE user_id = $1 AND ref_chirp_id = $2 AND ref_kind = 'rechirp';
+
+-- name: UpdateChirpBody :one
+UPDATE chirps
+SET body = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: SoftDeleteChirp :exec
+UPDATE chirps
+SET deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1;
+
+-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NOT NULL AND tombstoned_at IS NULL
+RETURNING *;
+
+-- name: GetDeletedChirpsByUser :many
+SELECT * FROM chirps
+WHERE user_id = sqlc.arg(user_id)::uuid
+  AND deleted_at >= sqlc.arg(deleted_since)::timestamp
+  AND tombstoned_at IS NULL
+ORDER BY deleted_at DESC;
+
+-- name: TombstoneDeletedChirps :execrows
+UPDATE chirps
+SET body = '', tombstoned_at = NOW()
+WHERE deleted_at < sqlc.arg(deleted_before)::timestamp
+  AND tombstoned_at IS NULL
+  AND EXISTS (
+    SELECT 1 FROM chirps child WHERE child.in_reply_to = chirps.id
+  );
+
+-- name: PurgeDeletedChirps :execrows
+WITH purged AS (
+  SELECT parent.id FROM chirps parent
+  WHERE parent.deleted_at < sqlc.arg(deleted_before)::timestamp
+    AND NOT EXISTS (
+      SELECT 1 FROM chirps child WHERE child.in_reply_to = parent.id
+    )
+)
+DELETE FROM chirps
+WHERE id IN (SELECT id FROM purged)
+  -- plain rechirps go with their original, quotes keep their own body
+  OR (ref_kind = 'rechirp' AND ref_chirp_id IN (SELECT id FROM purged));
+
+-- name: PublishDueChirps :many
+UPDATE chirps
+SET status = 'published', created_at = NOW(), updated_at = NOW()
+WHERE id IN (
+  SELECT due.id FROM chirps due
+  WHERE due.status = 'scheduled'
+    AND due.publish_at <= NOW()
+    AND due.deleted_at IS NULL
+  ORDER BY due.publish_at
+  LIMIT sqlc.arg(batch_size)
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: GetScheduledChirpsByUser :many
+SELECT * FROM chirps
+WHERE user_id = $1
+  AND status = 'scheduled'
+  AND deleted_at IS NULL
+ORDER BY publish_at ASC, id ASC;
+
+-- name: RescheduleChirp :one
+UPDATE chirps
+SET publish_at = $3, expires_at = expires_at + ($3 - publish_at), updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND status = 'scheduled' AND deleted_at IS NULL
+RETURNING *;
+
+-- name: CancelScheduledChirp :execrows
+DELETE FROM chirps
+WHERE id = $1 AND user_id = $2 AND status = 'scheduled';
+
+-- name: TombstoneExpiredChirps :execrows
+UPDATE chirps
+SET body = '', tombstoned_at = NOW(), deleted_at = COALESCE(deleted_at, NOW()), expires_at = NULL
+WHERE expires_at <= NOW()
+  AND EXISTS (
+    SELECT 1 FROM chirps child WHERE child.in_reply_to = chirps.id
+  );
+
+-- name: PurgeExpiredChirps :execrows
+WITH purged AS (
+  SELECT parent.id FROM chirps parent
+  WHERE parent.expires_at <= NOW()
+    AND NOT EXISTS (
+      SELECT 1 FROM chirps child WHERE child.in_reply_to = parent.id
+    )
+)
+DELETE FROM chirps
+WHERE id IN (SELECT id FROM purged)
+  -- rechirps follow their original, as in PurgeDeletedChirps
+  OR (ref_kind = 'rechirp' AND ref_chirp_id IN (SELECT id FROM purged));
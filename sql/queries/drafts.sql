@@ -0,0 +1,38 @@
+-- name: CreateDraft :one
+INSERT INTO drafts (
+  id,
+  created_at,
+  updated_at,
+  user_id,
+  body,
+  in_reply_to,
+  media_ids
+) VALUES (
+  gen_random_uuid(),
+  NOW(),
+  NOW(),
+  $1,
+  $2,
+  $3,
+  $4
+)
+RETURNING *;
+
+-- name: GetDraft :one
+SELECT * FROM drafts
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetDraftsByUser :many
+SELECT * FROM drafts
+WHERE user_id = $1
+ORDER BY updated_at DESC, id DESC;
+
+-- name: UpdateDraft :one
+UPDATE drafts
+SET body = $3, in_reply_to = $4, media_ids = $5, updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteDraft :execrows
+DELETE FROM drafts
+WHERE id = $1 AND user_id = $2;
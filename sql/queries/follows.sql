@@ -0,0 +1,46 @@
+-- name: FollowUser :exec
+INSERT INTO follows (
+  follower_id,
+  followee_id,
+  created_at
+) VALUES (
+  $1,
+  $2,
+  NOW()
+)
+ON CONFLICT DO NOTHING;
+
+-- name: UnfollowUser :execrows
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: GetFollowers :many
+SELECT follower_id AS user_id, created_at FROM follows
+WHERE followee_id = sqlc.arg(user_id)::uuid
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (created_at, follower_id) < (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at DESC, follower_id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: GetFollowing :many
+SELECT followee_id AS user_id, created_at FROM follows
+WHERE follower_id = sqlc.arg(user_id)::uuid
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (created_at, followee_id) < (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at DESC, followee_id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: GetTimeline :many
+SELECT * FROM chirps
+WHERE user_id IN (
+  SELECT followee_id FROM follows
+  WHERE follower_id = sqlc.arg(follower_id)::uuid
+)
+  AND deleted_at IS NULL
+  AND status = 'published'
+  AND (expires_at IS NULL OR expires_at > NOW())
+  AND chirp_visible_to(chirps, sqlc.arg(follower_id)::uuid)
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_size);
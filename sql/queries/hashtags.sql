@@ -0,0 +1,59 @@
+-- name: UpsertHashtag :one
+INSERT INTO hashtags (
+  id,
+  created_at,
+  tag
+) VALUES (
+  gen_random_uuid(),
+  NOW(),
+  $1
+)
+ON CONFLICT (tag) DO UPDATE SET tag = EXCLUDED.tag
+RETURNING *;
+
+-- name: AddChirpHashtag :exec
+INSERT INTO chirp_hashtags (
+  chirp_id,
+  hashtag_id,
+  created_at
+) VALUES (
+  $1,
+  $2,
+  NOW()
+)
+ON CONFLICT DO NOTHING;
+
+-- name: GetChirpsByHashtag :many
+SELECT * FROM chirps
+WHERE id IN (
+  SELECT chirp_hashtags.chirp_id FROM chirp_hashtags
+  JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+  WHERE hashtags.tag = sqlc.arg(tag)::text
+)
+  AND deleted_at IS NULL
+  AND status = 'published'
+  AND (expires_at IS NULL OR expires_at > NOW())
+  AND chirp_visible_to(chirps, sqlc.arg(viewer_id)::uuid)
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: GetTrendingHashtags :many
+SELECT hashtags.tag, COUNT(*) AS uses
+FROM chirp_hashtags
+JOIN hashtags ON hashtags.id = chirp_hashtags.hashtag_id
+JOIN chirps ON chirps.id = chirp_hashtags.chirp_id
+WHERE chirps.created_at >= sqlc.arg(since)::timestamp
+  AND chirps.deleted_at IS NULL
+  AND chirps.status = 'published'
+  AND (chirps.expires_at IS NULL OR chirps.expires_at > NOW())
+  -- no viewer, so only public chirps count
+  AND chirp_visible_to(chirps, NULL)
+GROUP BY hashtags.tag
+ORDER BY uses DESC, hashtags.tag ASC
+LIMIT sqlc.arg(page_size);
+
+-- name: DeleteChirpHashtags :exec
+DELETE FROM chirp_hashtags
+WHERE chirp_id = $1;
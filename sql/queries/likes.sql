@@ -0,0 +1,24 @@
+-- name: LikeChirp :exec
+INSERT INTO chirp_likes (
+  chirp_id,
+  user_id,
+  created_at
+) VALUES (
+  $1,
+  $2,
+  NOW()
+)
+ON CONFLICT DO NOTHING;
+
+-- name: UnlikeChirp :execrows
+DELETE FROM chirp_likes
+WHERE chirp_id = $1 AND user_id = $2;
+
+-- name: GetLikeStats :many
+SELECT
+  chirp_id,
+  COUNT(*) AS like_count,
+  BOOL_OR(user_id = sqlc.arg(viewer_id)::uuid)::boolean AS liked_by_me
+FROM chirp_likes
+WHERE chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+GROUP BY chirp_id;
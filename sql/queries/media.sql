@@ -0,0 +1,94 @@
+-- name: CreateMedia :one
+INSERT INTO media (
+  id,
+  created_at,
+  user_id,
+  content_type,
+  storage_key,
+  size_bytes,
+  width,
+  height
+) VALUES (
+  gen_random_uuid(),
+  NOW(),
+  $1,
+  $2,
+  $3,
+  $4,
+  $5,
+  $6
+)
+RETURNING *;
+
+-- name: GetMediaByIDs :many
+SELECT * FROM media
+WHERE id = ANY(sqlc.arg(ids)::uuid[]);
+
+-- name: AddChirpMedia :exec
+INSERT INTO chirp_media (
+  chirp_id,
+  media_id,
+  position
+) VALUES (
+  $1,
+  $2,
+  $3
+);
+
+-- name: GetMediaForChirps :many
+SELECT
+  chirp_media.chirp_id,
+  media.id,
+  media.content_type,
+  media.storage_key,
+  media.width,
+  media.height,
+  media.blurhash
+FROM chirp_media
+JOIN media ON media.id = chirp_media.media_id
+WHERE chirp_media.chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+ORDER BY chirp_media.chirp_id, chirp_media.position;
+
+-- name: ClaimUnprocessedMedia :many
+UPDATE media
+SET attempts = attempts + 1, claimed_at = NOW()
+WHERE id IN (
+  SELECT id FROM media
+  WHERE processed_at IS NULL
+  AND attempts < sqlc.arg(max_attempts)::int
+  -- a claim older than stale_before belongs to a worker that failed or died
+  AND (claimed_at IS NULL OR claimed_at < sqlc.arg(stale_before)::timestamp)
+  ORDER BY created_at
+  LIMIT sqlc.arg(batch_size)::int
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: CreateMediaVariant :exec
+INSERT INTO media_variants (
+  media_id,
+  name,
+  storage_key,
+  width,
+  height
+) VALUES (
+  $1,
+  $2,
+  $3,
+  $4,
+  $5
+)
+ON CONFLICT (media_id, name) DO UPDATE
+SET storage_key = EXCLUDED.storage_key,
+  width = EXCLUDED.width,
+  height = EXCLUDED.height;
+
+-- name: SetMediaProcessed :exec
+UPDATE media
+SET blurhash = $2, processed_at = NOW()
+WHERE id = $1;
+
+-- name: GetVariantsForMedia :many
+SELECT * FROM media_variants
+WHERE media_id = ANY(sqlc.arg(media_ids)::uuid[])
+ORDER BY media_id, width;
@@ -0,0 +1,36 @@
+-- name: CreateMentionNotifications :exec
+INSERT INTO notifications (
+  id,
+  created_at,
+  user_id,
+  kind,
+  actor_id,
+  chirp_id
+)
+SELECT
+  gen_random_uuid(),
+  NOW(),
+  mentioned.user_id,
+  'mention',
+  chirps.user_id,
+  chirps.id
+FROM chirps
+JOIN (
+  SELECT DISTINCT chirp_mentions.user_id FROM chirp_mentions
+  WHERE chirp_mentions.chirp_id = $1
+) mentioned ON mentioned.user_id <> chirps.user_id
+WHERE chirps.id = $1 AND chirps.status = 'published'
+ON CONFLICT DO NOTHING;
+
+-- name: GetNotifications :many
+SELECT * FROM notifications
+WHERE user_id = sqlc.arg(user_id)::uuid
+  AND (sqlc.narg(cursor_created_at)::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg(cursor_created_at)::timestamp, sqlc.narg(cursor_id)::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: MarkNotificationsRead :execrows
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL;
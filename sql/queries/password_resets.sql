@@ -0,0 +1,34 @@
+-- name: CreatePasswordReset :one
+INSERT INTO password_resets (
+  id,
+  created_at,
+  user_id,
+  token_hash,
+  expires_at
+) VALUES (
+  $1,
+  NOW(),
+  $2,
+  $3,
+  $4
+)
+RETURNING *;
+
+-- name: DeletePasswordResets :exec
+DELETE FROM password_resets
+WHERE user_id = $1;
+
+-- name: GetPasswordReset :one
+SELECT * FROM password_resets
+WHERE id = $1 AND used_at IS NULL AND expires_at > NOW();
+
+-- name: UsePasswordReset :execrows
+UPDATE password_resets
+SET used_at = NOW()
+WHERE id = $1 AND used_at IS NULL AND expires_at > NOW();
+
+-- name: GetLatestPasswordResetTime :one
+SELECT created_at FROM password_resets
+WHERE user_id = $1
+ORDER BY created_at DESC
+LIMIT 1;
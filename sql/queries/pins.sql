@@ -0,0 +1,28 @@
+-- name: PinChirp :exec
+INSERT INTO pinned_chirps (
+  user_id,
+  chirp_id,
+  created_at
+) VALUES (
+  $1,
+  $2,
+  NOW()
+)
+ON CONFLICT (user_id) DO UPDATE
+SET chirp_id = EXCLUDED.chirp_id, created_at = EXCLUDED.created_at;
+
+-- name: UnpinChirp :execrows
+DELETE FROM pinned_chirps
+WHERE user_id = $1 AND chirp_id = $2;
+
+-- name: DeletePinForChirp :exec
+DELETE FROM pinned_chirps
+WHERE chirp_id = $1;
+
+-- name: GetPinnedChirp :one
+SELECT * FROM chirps
+WHERE id = (SELECT chirp_id FROM pinned_chirps WHERE pinned_chirps.user_id = sqlc.arg(user_id)::uuid)
+  AND deleted_at IS NULL
+  AND status = 'published'
+  AND (expires_at IS NULL OR expires_at > NOW())
+  AND chirp_visible_to(chirps, sqlc.arg(viewer_id)::uuid);
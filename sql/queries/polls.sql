@@ -0,0 +1,57 @@
+-- name: CreatePoll :exec
+INSERT INTO polls (
+  chirp_id,
+  closes_at
+) VALUES (
+  $1,
+  $2
+);
+
+-- name: CreatePollOption :exec
+INSERT INTO poll_options (
+  id,
+  chirp_id,
+  position,
+  body
+) VALUES (
+  gen_random_uuid(),
+  $1,
+  $2,
+  $3
+);
+
+-- name: GetPoll :one
+SELECT * FROM polls
+WHERE chirp_id = $1;
+
+-- name: GetPollsForChirps :many
+SELECT * FROM polls
+WHERE chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[]);
+
+-- name: GetPollOptionsForChirps :many
+SELECT
+  poll_options.chirp_id,
+  poll_options.id,
+  poll_options.body,
+  COUNT(poll_votes.user_id) AS votes,
+  COALESCE(BOOL_OR(poll_votes.user_id = sqlc.arg(viewer_id)::uuid), false)::boolean AS voted_by_me
+FROM poll_options
+LEFT JOIN poll_votes ON poll_votes.option_id = poll_options.id
+WHERE poll_options.chirp_id = ANY(sqlc.arg(chirp_ids)::uuid[])
+GROUP BY poll_options.id
+ORDER BY poll_options.chirp_id, poll_options.position;
+
+-- name: VotePoll :execrows
+INSERT INTO poll_votes (
+  chirp_id,
+  user_id,
+  option_id,
+  created_at
+)
+SELECT
+  poll_options.chirp_id,
+  sqlc.arg(user_id)::uuid,
+  poll_options.id,
+  NOW()
+FROM poll_options
+WHERE poll_options.id = sqlc.arg(option_id) AND poll_options.chirp_id = sqlc.arg(chirp_id);
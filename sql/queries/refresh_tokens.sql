@@ -27,3 +27,8 @@ UPDATE refresh_tokens
 SET revoked_at = $2, updated_at = $2
 WHERE token = $1
 RETURNING *;
+
+-- name: RevokeOtherRefreshTokens :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW(), updated_at = NOW()
+WHERE user_id = $1 AND token <> $2 AND revoked_at IS NULL;
@@ -4,15 +4,17 @@ INSERT INTO users (
   created_at,
   updated_at,
   email,
-  hashed_password
+  hashed_password,
+  handle
 ) VALUES ( 
   gen_random_uuid(),
   NOW(),
   NOW(),
   $1,
-  $2
+  $2,
+  $3
 )
-RETURNING id,created_at,updated_at,email;
+RETURNING id,created_at,updated_at,email,handle;
 
 -- name: Reset :exec
 DELETE FROM users;
@@ -23,6 +25,55 @@ WHERE email=$1;
 
 -- name: UpdateCredentials :one
 UPDATE users
-SET email = $2, hashed_password = $3
-WHERE id = $1
+SET email = COALESCE(sqlc.narg(email), email),
+  hashed_password = COALESCE(sqlc.narg(hashed_password), hashed_password),
+  handle = COALESCE(sqlc.narg(handle), handle),
+  email_verified_at = CASE WHEN sqlc.narg(email)::text IS NULL THEN email_verified_at ELSE NULL END,
+  updated_at = NOW()
+WHERE id = sqlc.arg(id)
 RETURNING *;
+
+-- name: GetUserByID :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: GetUserByHandle :one
+SELECT * FROM users
+WHERE LOWER(handle) = LOWER($1);
+
+-- name: GetUserProfile :one
+SELECT
+  users.id,
+  users.created_at,
+  users.handle,
+  users.display_name,
+  users.bio,
+  users.location,
+  users.website,
+  media.storage_key AS avatar_key,
+  (SELECT COUNT(*) FROM chirps
+    WHERE chirps.user_id = users.id
+      AND chirps.deleted_at IS NULL
+      AND chirps.status = 'published'
+      AND (chirps.expires_at IS NULL OR chirps.expires_at > NOW())
+      AND chirp_visible_to(chirps, sqlc.arg(viewer_id)::uuid)) AS chirp_count,
+  (SELECT COUNT(*) FROM follows WHERE follows.followee_id = users.id) AS follower_count,
+  (SELECT COUNT(*) FROM follows WHERE follows.follower_id = users.id) AS following_count
+FROM users
+LEFT JOIN media ON media.id = users.avatar_media_id
+WHERE users.id = sqlc.arg(id);
+
+-- name: UpdateProfile :exec
+UPDATE users
+SET display_name = COALESCE(sqlc.narg(display_name), display_name),
+  bio = COALESCE(sqlc.narg(bio), bio),
+  location = COALESCE(sqlc.narg(location), location),
+  website = COALESCE(sqlc.narg(website), website),
+  avatar_media_id = CASE WHEN sqlc.arg(set_avatar)::boolean THEN sqlc.narg(avatar_media_id)::uuid ELSE avatar_media_id END,
+  updated_at = NOW()
+WHERE id = sqlc.arg(id);
+
+-- name: VerifyEmail :execrows
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2 AND email_verified_at IS NULL;
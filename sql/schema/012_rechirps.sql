@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN ref_chirp_id UUID REFERENCES chirps(id) ON DELETE SET NULL,
+ADD COLUMN ref_kind TEXT CHECK (ref_kind IN ('rechirp', 'quote'));
+
+CREATE UNIQUE INDEX chirps_user_id_rechirp_idx ON chirps (user_id, ref_chirp_id)
+WHERE ref_kind = 'rechirp';
+
+-- +goose Down
+DROP INDEX chirps_user_id_rechirp_idx;
+ALTER TABLE chirps
+DROP COLUMN ref_kind,
+DROP COLUMN ref_chirp_id;
@@ -0,0 +1,20 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN deleted_at TIMESTAMP;
+
+UPDATE chirps SET deleted_at = tombstoned_at WHERE tombstoned_at IS NOT NULL;
+
+CREATE INDEX chirps_deleted_at_idx ON chirps (deleted_at) WHERE deleted_at IS NOT NULL;
+
+DROP INDEX chirps_user_id_rechirp_idx;
+CREATE UNIQUE INDEX chirps_user_id_rechirp_idx ON chirps (user_id, ref_chirp_id)
+WHERE ref_kind = 'rechirp' AND deleted_at IS NULL;
+
+-- +goose Down
+DROP INDEX chirps_user_id_rechirp_idx;
+CREATE UNIQUE INDEX chirps_user_id_rechirp_idx ON chirps (user_id, ref_chirp_id)
+WHERE ref_kind = 'rechirp';
+
+DROP INDEX chirps_deleted_at_idx;
+ALTER TABLE chirps
+DROP COLUMN deleted_at;
@@ -0,0 +1,18 @@
+-- +goose Up
+ALTER TABLE media ADD COLUMN blurhash TEXT;
+ALTER TABLE media ADD COLUMN processed_at TIMESTAMP;
+
+CREATE TABLE media_variants(
+  media_id UUID NOT NULL,
+  name TEXT NOT NULL,
+  storage_key TEXT UNIQUE NOT NULL,
+  width INTEGER NOT NULL,
+  height INTEGER NOT NULL,
+  PRIMARY KEY(media_id, name),
+  FOREIGN KEY(media_id) REFERENCES media(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE media_variants;
+ALTER TABLE media DROP COLUMN processed_at;
+ALTER TABLE media DROP COLUMN blurhash;
@@ -0,0 +1,31 @@
+-- +goose Up
+CREATE TABLE polls(
+  chirp_id UUID PRIMARY KEY,
+  closes_at TIMESTAMP NOT NULL,
+  FOREIGN KEY(chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+CREATE TABLE poll_options(
+  id UUID PRIMARY KEY,
+  chirp_id UUID NOT NULL,
+  position INTEGER NOT NULL CHECK (position BETWEEN 0 AND 3),
+  body TEXT NOT NULL,
+  UNIQUE(chirp_id, position),
+  FOREIGN KEY(chirp_id) REFERENCES polls(chirp_id) ON DELETE CASCADE
+);
+
+CREATE TABLE poll_votes(
+  chirp_id UUID NOT NULL,
+  user_id UUID NOT NULL,
+  option_id UUID NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  UNIQUE(chirp_id, user_id),
+  FOREIGN KEY(chirp_id) REFERENCES polls(chirp_id) ON DELETE CASCADE,
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY(option_id) REFERENCES poll_options(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE poll_votes;
+DROP TABLE poll_options;
+DROP TABLE polls;
@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE chirps ADD COLUMN status TEXT NOT NULL DEFAULT 'published'
+  CHECK (status IN ('scheduled', 'published'));
+ALTER TABLE chirps ADD COLUMN publish_at TIMESTAMP;
+CREATE INDEX chirps_scheduled_idx ON chirps (publish_at) WHERE status = 'scheduled';
+
+-- +goose Down
+DROP INDEX chirps_scheduled_idx;
+ALTER TABLE chirps DROP COLUMN publish_at;
+ALTER TABLE chirps DROP COLUMN status;
@@ -0,0 +1,16 @@
+-- +goose Up
+CREATE TABLE drafts(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  updated_at TIMESTAMP NOT NULL,
+  user_id UUID NOT NULL,
+  body TEXT NOT NULL,
+  in_reply_to UUID,
+  media_ids UUID[] NOT NULL DEFAULT '{}',
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX drafts_user_updated_idx ON drafts (user_id, updated_at DESC);
+
+-- +goose Down
+DROP TABLE drafts;
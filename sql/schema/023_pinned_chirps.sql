@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE pinned_chirps(
+  user_id UUID PRIMARY KEY,
+  chirp_id UUID UNIQUE NOT NULL,
+  created_at TIMESTAMP NOT NULL,
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY(chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE pinned_chirps;
@@ -0,0 +1,42 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN handle TEXT;
+
+CREATE UNIQUE INDEX users_handle_lower_idx ON users (LOWER(handle));
+
+CREATE TABLE chirp_mentions(
+  chirp_id UUID NOT NULL,
+  user_id UUID NOT NULL,
+  start_offset INTEGER NOT NULL,
+  end_offset INTEGER NOT NULL,
+  PRIMARY KEY(chirp_id, start_offset),
+  FOREIGN KEY(chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX chirp_mentions_user_id_idx ON chirp_mentions (user_id, chirp_id);
+
+CREATE TABLE notifications(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  user_id UUID NOT NULL,
+  kind TEXT NOT NULL,
+  actor_id UUID NOT NULL,
+  chirp_id UUID NOT NULL,
+  read_at TIMESTAMP,
+  UNIQUE(user_id, kind, chirp_id),
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY(actor_id) REFERENCES users(id) ON DELETE CASCADE,
+  FOREIGN KEY(chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_user_created_at_idx ON notifications (user_id, created_at DESC, id DESC);
+
+-- +goose Down
+DROP TABLE notifications;
+DROP TABLE chirp_mentions;
+
+DROP INDEX users_handle_lower_idx;
+
+ALTER TABLE users
+DROP COLUMN handle;
@@ -0,0 +1,11 @@
+-- +goose Up
+UPDATE users
+SET handle = 'user_' || SUBSTR(MD5(id::text), 1, 10)
+WHERE handle IS NULL;
+
+ALTER TABLE users
+ALTER COLUMN handle SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE users
+ALTER COLUMN handle DROP NOT NULL;
@@ -0,0 +1,15 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN display_name TEXT NOT NULL DEFAULT '',
+ADD COLUMN bio TEXT NOT NULL DEFAULT '',
+ADD COLUMN avatar_media_id UUID REFERENCES media(id) ON DELETE SET NULL,
+ADD COLUMN location TEXT NOT NULL DEFAULT '',
+ADD COLUMN website TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN display_name,
+DROP COLUMN bio,
+DROP COLUMN avatar_media_id,
+DROP COLUMN location,
+DROP COLUMN website;
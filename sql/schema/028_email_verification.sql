@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP;
+
+-- accounts from before verification existed are trusted as they are
+UPDATE users
+SET email_verified_at = created_at;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN email_verified_at;
@@ -0,0 +1,15 @@
+-- +goose Up
+CREATE TABLE password_resets(
+  id UUID PRIMARY KEY,
+  created_at TIMESTAMP NOT NULL,
+  user_id UUID NOT NULL,
+  token_hash TEXT NOT NULL,
+  expires_at TIMESTAMP NOT NULL,
+  used_at TIMESTAMP,
+  FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX password_resets_user_id_idx ON password_resets (user_id);
+
+-- +goose Down
+DROP TABLE password_resets;
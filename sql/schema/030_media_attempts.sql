@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE media
+ADD COLUMN attempts INT NOT NULL DEFAULT 0,
+ADD COLUMN claimed_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE media
+DROP COLUMN claimed_at,
+DROP COLUMN attempts;
@@ -0,0 +1,20 @@
+-- +goose Up
+-- the one place deciding who can read a chirp, shared by every read query;
+-- mentioned users can read the chirp whatever its visibility
+-- +goose StatementBegin
+CREATE FUNCTION chirp_visible_to(chirp chirps, viewer UUID) RETURNS BOOLEAN AS $$
+  SELECT chirp.visibility = 'public'
+    OR chirp.user_id = viewer
+    OR (chirp.visibility = 'followers' AND EXISTS (
+      SELECT 1 FROM follows
+      WHERE follows.follower_id = viewer AND follows.followee_id = chirp.user_id
+    ))
+    OR EXISTS (
+      SELECT 1 FROM chirp_mentions
+      WHERE chirp_mentions.chirp_id = chirp.id AND chirp_mentions.user_id = viewer
+    )
+$$ LANGUAGE sql STABLE;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION chirp_visible_to(chirps, UUID);